@@ -0,0 +1,72 @@
+package dirchanges
+
+import (
+	"fmt"
+	"sort"
+)
+
+// atimeOptions are the mount options with which access times are not
+// updated on every read, so that Access events can be missed.
+var atimeOptions = []string{
+	"noatime",    // never updated.
+	"nodiratime", // never updated for directories.
+	"relatime",   // updated once after each change, or once a day.
+}
+
+// An AtimeWarning tells that a watched name is on a mount whose options
+// keep access times from being updated on every read.
+type AtimeWarning struct {
+	Name       string // watched name.
+	MountPoint string // where the file system it's on is mounted.
+	Option     string // mount option, like "noatime" or "relatime".
+}
+
+// String prints the warning.
+func (w AtimeWarning) String() string {
+	return fmt.Sprintf("%s is on %s, mounted with %s: access times are not updated on every read",
+		w.Name, w.MountPoint, w.Option)
+}
+
+// AtimeWarnings checks the mounts the watched names are on, for
+// CompareOptions.DetectAccess. Mounts are only known on linux; elsewhere,
+// and for watchers of an fs.FS, there are no warnings.
+func (w *Watcher) AtimeWarnings() ([]AtimeWarning, error) {
+	if _, ok := w.fs.(osFileSystem); !ok {
+		return nil, nil
+	}
+	mounts, err := readMounts()
+	if err != nil || mounts == nil {
+		return nil, err
+	}
+
+	var res []AtimeWarning
+	for name := range w.names {
+		real, err := w.fs.EvalSymlinks(name)
+		if err != nil {
+			return nil, err
+		}
+		m, found := mountOf(mounts, real)
+		if !found {
+			continue
+		}
+		for _, option := range atimeOptions {
+			if m.hasOption(option) {
+				res = append(res, AtimeWarning{Name: name, MountPoint: m.point, Option: option})
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Name != res[j].Name {
+			return res[i].Name < res[j].Name
+		}
+		return res[i].Option < res[j].Option
+	})
+	return res, nil
+}
+
+// accessed reports whether the access time of a file advanced from oldFi
+// to fi. Files without recorded access times are never accessed, and
+// neither are directories, which the watcher reads itself to list them.
+func accessed(oldFi, fi *fileInfo) bool {
+	return !fi.dir && !oldFi.accessTime.IsZero() && fi.accessTime.After(oldFi.accessTime)
+}
@@ -0,0 +1,81 @@
+package dirchanges
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCompareAccess(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Second)
+
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/d":      &fileInfo{name: "d", mode: os.ModeDir | 0755, modTime: t1, dir: true, accessTime: t1},
+		"/d/read": &fileInfo{name: "read", mode: 0644, modTime: t1, accessTime: t1},
+		"/d/kept": &fileInfo{name: "kept", mode: 0644, modTime: t1, accessTime: t1},
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/d":      &fileInfo{name: "d", mode: os.ModeDir | 0755, modTime: t1, dir: true, accessTime: t2},
+		"/d/read": &fileInfo{name: "read", mode: 0644, modTime: t1, accessTime: t2},
+		"/d/kept": &fileInfo{name: "kept", mode: 0644, modTime: t1, accessTime: t1},
+	}}
+
+	if events := Compare(old, new); len(events) != 0 {
+		t.Errorf("expected no events without DetectAccess, got %v", eventStrings(events))
+	}
+	events := CompareWith(old, new, CompareOptions{DetectAccess: true})
+	if len(events) != 1 || events[0].Op != Access || events[0].Path != "/d/read" {
+		t.Errorf("expected /d/read to be accessed, got %v", eventStrings(events))
+	}
+}
+
+func TestAccess(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		return
+	}
+
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	name := filepath.Join(testDir, "file.txt")
+	// Even with relatime, reading a file updates an access time older
+	// than its modification time.
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, info.ModTime().Add(-time.Hour), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New()
+	w.SetCompareOptions(CompareOptions{DetectAccess: true})
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+	warnings, err := w.AtimeWarnings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, warning := range warnings {
+		if warning.Option == "noatime" {
+			t.Skip(warning)
+		}
+	}
+
+	if _, err := ioutil.ReadFile(name); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 1 || diff[0].Op != Access || diff[0].Path != name {
+		t.Errorf("expected %s to be accessed, got %v", name, eventStrings(diff))
+	}
+}
@@ -0,0 +1,158 @@
+package dirchanges
+
+import (
+	"strings"
+	"time"
+)
+
+// A Change is a bitmask of what changed about a file that is in both
+// snapshots compared.
+type Change uint32
+
+// Changes
+const (
+	// ChangeContent is set when the file was written, as decided by the
+	// DetectMode.
+	ChangeContent Change = 1 << iota
+	// ChangeModTime is set when the modification time changed.
+	ChangeModTime
+	// ChangeMode is set when the mode, permissions included, changed.
+	ChangeMode
+	// ChangeOwner is set when the owner or the group changed.
+	ChangeOwner
+	// ChangeSize is set when the size changed.
+	ChangeSize
+	// ChangeIdentity is set when the path is another file, with another
+	// device or inode.
+	ChangeIdentity
+	// ChangeXattr is set when extended attributes were added, removed or
+	// modified.
+	ChangeXattr
+	// ChangeAccess is set when the access time advanced, with
+	// CompareOptions.DetectAccess.
+	ChangeAccess
+	// ChangeLinks is set when the number of hard links of a file, other
+	// than a directory, changed.
+	ChangeLinks
+	// ChangeTarget is set when a symbolic link was retargeted.
+	ChangeTarget
+	// ChangeDevice is set when a device file stands for another device.
+	ChangeDevice
+	// ChangeType is set when the file was replaced by another kind of
+	// file.
+	ChangeType
+)
+
+var changeNames = []struct {
+	change Change
+	name   string
+}{
+	{ChangeContent, "CONTENT"},
+	{ChangeModTime, "MODTIME"},
+	{ChangeMode, "MODE"},
+	{ChangeOwner, "OWNER"},
+	{ChangeSize, "SIZE"},
+	{ChangeIdentity, "IDENTITY"},
+	{ChangeXattr, "XATTR"},
+	{ChangeAccess, "ACCESS"},
+	{ChangeLinks, "LINKS"},
+	{ChangeTarget, "TARGET"},
+	{ChangeDevice, "DEVICE"},
+	{ChangeType, "TYPE"},
+}
+
+// String prints the names of the changes in c, separated by "|".
+func (c Change) String() string {
+	var names []string
+	for _, n := range changeNames {
+		if c&n.change != 0 {
+			names = append(names, n.name)
+			c &^= n.change
+		}
+	}
+	if c != 0 {
+		names = append(names, "???")
+	}
+	return strings.Join(names, "|")
+}
+
+// opChanges are the changes a coalesced event has when the Op would have
+// been reported on its own. FilterOps keeps coalesced events that have
+// any of the changes of the filtered ops. The other ops are about paths
+// that are in only one snapshot, which are never coalesced.
+var opChanges = map[Op]Change{
+	Write:        ChangeContent,
+	Chmod:        ChangeMode,
+	Retarget:     ChangeTarget,
+	TypeChange:   ChangeType,
+	Replace:      ChangeIdentity,
+	Chown:        ChangeOwner,
+	Xattr:        ChangeXattr,
+	Access:       ChangeAccess,
+	DeviceChange: ChangeDevice,
+	Attrib:       ChangeModTime | ChangeSize | ChangeLinks,
+}
+
+// changesOf returns what changed from oldFi to fi, whose modification
+// times have the given precision.
+func changesOf(oldFi, fi *fileInfo, opts CompareOptions, precision time.Duration) Change {
+	var c Change
+	if written(oldFi, fi, opts.Detect, precision) {
+		c |= ChangeContent
+	}
+	if !sameModTime(oldFi.modTime, fi.modTime, precision) {
+		c |= ChangeModTime
+	}
+	if oldFi.mode != fi.mode {
+		c |= ChangeMode
+	}
+	if chowned(oldFi, fi) {
+		c |= ChangeOwner
+	}
+	if oldFi.size != fi.size {
+		c |= ChangeSize
+	}
+	if replaced(oldFi, fi) {
+		c |= ChangeIdentity
+	}
+	if !xattrChanges(oldFi, fi).empty() {
+		c |= ChangeXattr
+	}
+	if opts.DetectAccess && accessed(oldFi, fi) {
+		c |= ChangeAccess
+	}
+	if !fi.dir && oldFi.nlink != fi.nlink {
+		c |= ChangeLinks
+	}
+	if retargeted(oldFi, fi) {
+		c |= ChangeTarget
+	}
+	if deviceChanged(oldFi, fi) {
+		c |= ChangeDevice
+	}
+	if fileTypeOf(oldFi.mode) != fileTypeOf(fi.mode) {
+		c |= ChangeType
+	}
+	return c
+}
+
+// filterOps returns the events whose Op is in ops, and with coalesced
+// set, the events that have a change of one of ops.
+func filterOps(events []Event, ops map[Op]struct{}, coalesced bool) []Event {
+	var res []Event
+	for _, event := range events {
+		_, found := ops[event.Op]
+		if !found && coalesced {
+			for op := range ops {
+				if event.Changes&opChanges[op] != 0 {
+					found = true
+					break
+				}
+			}
+		}
+		if found {
+			res = append(res, event)
+		}
+	}
+	return res
+}
@@ -0,0 +1,82 @@
+package dirchanges
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestChangeString(t *testing.T) {
+	testCases := map[Change]string{
+		0:                            "",
+		ChangeContent:                "CONTENT",
+		ChangeMode | ChangeContent:   "CONTENT|MODE",
+		ChangeIdentity | 1<<31:       "IDENTITY|???",
+		ChangeModTime | ChangeSize:   "MODTIME|SIZE",
+		ChangeOwner | ChangeIdentity: "OWNER|IDENTITY",
+		ChangeLinks | ChangeType:     "LINKS|TYPE",
+	}
+	for c, expected := range testCases {
+		if c.String() != expected {
+			t.Errorf("expected %s, got %s", expected, c)
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Second)
+
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/d/both":  &fileInfo{name: "both", size: 1, mode: 0644, modTime: t1},
+		"/d/chmod": &fileInfo{name: "chmod", size: 1, mode: 0644, modTime: t1},
+		"/d/touch": &fileInfo{name: "touch", size: 1, mode: 0644, modTime: t1, hash: []byte{1}},
+		"/d/link":  &fileInfo{name: "link", size: 1, mode: 0644, modTime: t1, nlink: 1},
+		"/d/sym":   &fileInfo{name: "sym", mode: os.ModeSymlink | 0777, modTime: t1, target: "a", hasID: true, ino: 1},
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/d/both":  &fileInfo{name: "both", size: 2, mode: 0755, modTime: t2},
+		"/d/chmod": &fileInfo{name: "chmod", size: 1, mode: 0600, modTime: t1},
+		"/d/touch": &fileInfo{name: "touch", size: 1, mode: 0644, modTime: t2, hash: []byte{1}},
+		"/d/link":  &fileInfo{name: "link", size: 1, mode: 0644, modTime: t1, nlink: 2},
+		"/d/sym":   &fileInfo{name: "sym", mode: os.ModeSymlink | 0777, modTime: t1, target: "b", hasID: true, ino: 2},
+	}}
+
+	opts := CompareOptions{Detect: DetectContent}
+	if events := CompareWith(old, new, opts); len(events) != 5 {
+		t.Errorf("expected 5 events without coalescing, got %v", eventStrings(events))
+	}
+
+	expected := map[string]Event{
+		"/d/both":  {Op: Write, Changes: ChangeContent | ChangeModTime | ChangeMode | ChangeSize},
+		"/d/chmod": {Op: Chmod, Changes: ChangeMode},
+		// Changes without an op of their own are still reported.
+		"/d/touch": {Op: Attrib, Changes: ChangeModTime},
+		"/d/link":  {Op: Attrib, Changes: ChangeLinks},
+		"/d/sym":   {Op: Replace, Changes: ChangeIdentity | ChangeTarget},
+	}
+	opts.Coalesce = true
+	events := CompareWith(old, new, opts)
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %v", len(expected), eventStrings(events))
+	}
+	for _, e := range events {
+		if ex := expected[e.Path]; e.Op != ex.Op || e.Changes != ex.Changes {
+			t.Errorf("expected %s %s [%s], got %s [%s]", e.Path, ex.Op, ex.Changes, e.Op, e.Changes)
+		}
+	}
+
+	// Filtering by op matches the changes of coalesced events.
+	ops := map[Op]struct{}{Chmod: {}}
+	if filtered := filterOps(events, ops, true); len(filtered) != 2 {
+		t.Errorf("expected only /d/both and /d/chmod to have a mode change, got %v", eventStrings(filtered))
+	}
+	ops = map[Op]struct{}{Retarget: {}}
+	if filtered := filterOps(events, ops, true); len(filtered) != 1 || filtered[0].Path != "/d/sym" {
+		t.Errorf("expected only /d/sym to be retargeted, got %v", eventStrings(filtered))
+	}
+	ops = map[Op]struct{}{Write: {}}
+	if filtered := filterOps(events, ops, true); len(filtered) != 1 || filtered[0].Path != "/d/both" {
+		t.Errorf("expected only /d/both to be written, got %v", eventStrings(filtered))
+	}
+}
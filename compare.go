@@ -0,0 +1,427 @@
+package dirchanges
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// CompareOptions changes how snapshots are compared.
+type CompareOptions struct {
+	// Detect is how a file is found to be written. See SetDetectMode.
+	Detect DetectMode
+
+	// CollapseMoves reports a moved directory as a single Move or Rename.
+	// Files that moved along with it are only reported when they were
+	// also changed, by events with the new path in Path and the old one
+	// in OldPath.
+	CollapseMoves bool
+
+	// IdentityKey returns a comparable key that identifies the file
+	// described by info, so that it can be found after a rename or move.
+	// ok is false if info can't be identified. When nil, the device and
+	// inode of the file are used, or on windows, where os.FileInfo has no
+	// identity, its modification time, size and mode.
+	IdentityKey func(info os.FileInfo) (key interface{}, ok bool)
+
+	// RenameSimilarity, when above 0, pairs removed and created files that
+	// could not be identified as the same file, but whose content is at
+	// least RenameSimilarity percent similar, like git's -M option. They
+	// are reported as moves and renames with their similarity in Score.
+	//
+	// A Watcher records the content needed for this when adding files, so
+	// the option should be set before.
+	RenameSimilarity int
+
+	// RenameLimit, like git's diff.renameLimit, bounds the work done by
+	// RenameSimilarity: as similar files are found by comparing each
+	// removed file to each created one, only identical files are paired
+	// when the number of removed times created regular files is above
+	// RenameLimit squared. When 0, DefaultRenameLimit is used, and when
+	// negative, there is no limit.
+	RenameLimit int
+
+	// DetectCopies reports a created file whose content is the same as
+	// the one of a file in the old snapshot as a Copy of it, with the
+	// path of the copied file in OldPath. Empty files are never copies.
+	//
+	// A Watcher hashes files for this when adding them, so the option
+	// should be set before.
+	DetectCopies bool
+
+	// SuspectCtime reports a file whose inode change time changed while
+	// its modification time and its other metadata didn't as a Write with
+	// Suspicious set, as happens when the modification time is reset
+	// after writing, by touch -r, rsync -t or tar. Files whose content
+	// was compared and found equal are not reported. Change times are
+	// only recorded on linux.
+	//
+	// In DetectHybrid mode, a Watcher also hashes the files whose change
+	// time changed again.
+	SuspectCtime bool
+
+	// DetectAccess reports files whose access time advanced as Access
+	// events. Directories are left out, as listing them reads them.
+	// Access times are only recorded on linux, and are not
+	// updated on every read on most mounts; see Watcher.AtimeWarnings.
+	// The watcher reads files itself without updating their access time
+	// when it's allowed to, as the owner of the files or as root.
+	DetectAccess bool
+
+	// ModTimePrecision is the resolution of modification times. Times
+	// less than ModTimePrecision apart are taken as equal, for file
+	// systems that round them, such as FAT with 2 seconds, or snapshots
+	// that went through a format that truncates them. When 0, times are
+	// compared exactly.
+	ModTimePrecision time.Duration
+
+	// ModTimePrecisions overrides ModTimePrecision for the files in some
+	// directories, by directory. The longest directory that contains a
+	// file applies. See also Watcher.DetectModTimePrecision.
+	ModTimePrecisions map[string]time.Duration
+
+	// Coalesce reports at most one event for each path that is in both
+	// snapshots, with everything that changed in its Changes. Its Op is
+	// the first of TypeChange, Replace, Retarget, DeviceChange, Write,
+	// Chmod, Chown, Xattr and Access that applies, or Attrib when none
+	// does but something else, like the modification time, changed.
+	Coalesce bool
+}
+
+// SetCompareOptions sets how the watcher compares files in Diff. It
+// replaces the mode set by SetDetectMode with opts.Detect.
+func (w *Watcher) SetCompareOptions(opts CompareOptions) {
+	w.compare = opts
+	w.scanned = nil
+}
+
+// Compare returns the events that describe how the files recorded in old
+// changed into the files recorded in new. Neither snapshot is modified.
+func Compare(old, new Snapshot) []Event {
+	return CompareWith(old, new, CompareOptions{})
+}
+
+// CompareWith is like Compare, with options.
+func CompareWith(old, new Snapshot, opts CompareOptions) []Event {
+
+	var res []Event
+
+	// Store create and remove events for use to check for rename events.
+	creates := make(map[string]os.FileInfo)
+	removes := make(map[string]os.FileInfo)
+
+	// Check for removed files.
+	for path, info := range old.Files {
+		if _, found := new.Files[path]; !found {
+			removes[path] = info
+		}
+	}
+
+	// Check for created files, writes and chmods.
+	for path, info := range new.Files {
+		oldInfo, found := old.Files[path]
+		if !found {
+			// A file was created.
+			creates[path] = info
+			continue
+		}
+		res = append(res, changes(path, path, oldInfo, info, opts)...)
+	}
+
+	// Check for renames and moves, by looking up the identity of each
+	// removed file among the created ones.
+	identityKey := opts.IdentityKey
+	if identityKey == nil {
+		identityKey = defaultIdentityKey
+	}
+	index := make(map[interface{}][]string)
+	for path, info := range creates {
+		if key, ok := identityKey(info); ok {
+			index[key] = append(index[key], path)
+		}
+	}
+	// Pair files that share an identity, like hard links, in order.
+	for _, paths := range index {
+		sort.Strings(paths)
+	}
+
+	var moves []Event
+	for _, path1 := range sortedPaths(removes) {
+		info1 := removes[path1]
+		key, ok := identityKey(info1)
+		if !ok || len(index[key]) == 0 {
+			continue
+		}
+		path2 := index[key][0]
+		index[key] = index[key][1:]
+
+		e := Event{
+			Op:       Move,
+			Path:     path2,
+			OldPath:  path1,
+			FileInfo: info1,
+			OldInfo:  info1,
+			NewInfo:  creates[path2],
+		}
+		// If they are from the same directory, it's a rename
+		// instead of a move event.
+		if filepath.Dir(path1) == filepath.Dir(path2) {
+			e.Op = Rename
+		}
+
+		delete(removes, path1)
+		delete(creates, path2)
+
+		moves = append(moves, e)
+	}
+	if opts.CollapseMoves {
+		moves = collapseMoves(moves, new, opts)
+	}
+	replacedBy(res, removes, identityKey)
+	res = append(res, findLinks(old, new, creates, removes)...)
+	if opts.RenameSimilarity > 0 {
+		moves = append(moves, pairBySimilarity(removes, creates, opts.RenameSimilarity, opts.RenameLimit)...)
+	}
+	res = append(res, moves...)
+
+	if opts.DetectCopies {
+		res = append(res, findCopies(old, creates)...)
+	}
+
+	// Send all the remaining create and remove events.
+	for path, info := range creates {
+		res = append(res, Event{Op: Create, Path: path, FileInfo: info, NewInfo: info})
+	}
+	for path, info := range removes {
+		res = append(res, Event{Op: Remove, Path: path, OldPath: path, FileInfo: info, OldInfo: info})
+	}
+
+	for i := range res {
+		describeTypes(&res[i])
+	}
+	return res
+}
+
+// changes returns the events that describe how a file that is in both
+// snapshots changed from oldInfo, at oldPath, to info, at path.
+func changes(path, oldPath string, oldInfo, info os.FileInfo, opts CompareOptions) []Event {
+	var res []Event
+	oldFi, fi := toFileInfo(oldInfo), toFileInfo(info)
+	precision := opts.precisionOf(path)
+	changed := changesOf(oldFi, fi, opts, precision)
+	xattrs := xattrChanges(oldFi, fi)
+	event := func(op Op) Event {
+		e := Event{
+			Op:       op,
+			Path:     path,
+			OldPath:  oldPath,
+			FileInfo: info,
+			OldInfo:  oldInfo,
+			NewInfo:  info,
+			OldLinks: oldFi.nlink,
+			Links:    fi.nlink,
+			OldOwner: oldFi.owner,
+			Owner:    fi.owner,
+			Xattrs:   xattrs,
+			Changes:  changed,
+		}
+		if retargeted(oldFi, fi) {
+			e.OldTarget, e.Target = oldFi.target, fi.target
+		}
+		return e
+	}
+
+	if oldType, typ := fileTypeOf(oldFi.mode), fileTypeOf(fi.mode); oldType != typ {
+		// The file was replaced by another kind of file, so its
+		// content and mode can't be compared.
+		e := event(TypeChange)
+		e.OldType, e.Type = oldType, typ
+		return append(res, e)
+	}
+	isReplaced := replaced(oldFi, fi)
+	if isReplaced {
+		// The file at path was replaced by another one, as editors do
+		// when they save by renaming a new file over the old one. How
+		// its content and mode changed is still reported.
+		res = append(res, event(Replace))
+	}
+	if retargeted(oldFi, fi) {
+		res = append(res, event(Retarget))
+	} else if deviceChanged(oldFi, fi) {
+		res = append(res, event(DeviceChange))
+	} else if written(oldFi, fi, opts.Detect, precision) {
+		res = append(res, event(Write))
+	} else if !isReplaced && opts.SuspectCtime && suspicious(oldFi, fi, opts.Detect) {
+		e := event(Write)
+		e.Suspicious = true
+		res = append(res, e)
+	}
+	if oldInfo.Mode() != info.Mode() {
+		res = append(res, event(Chmod))
+	}
+	if chowned(oldFi, fi) {
+		res = append(res, event(Chown))
+	}
+	if !xattrs.empty() {
+		res = append(res, event(Xattr))
+	}
+	if opts.DetectAccess && accessed(oldFi, fi) {
+		res = append(res, event(Access))
+	}
+	if opts.Coalesce && len(res) > 1 {
+		// The first event already has all the changes.
+		res = res[:1]
+	} else if opts.Coalesce && len(res) == 0 && changed != 0 {
+		// Only changes that have no op of their own, like the
+		// modification time of a file touched under DetectContent or
+		// its number of links, are reported as a change of attributes.
+		res = append(res, event(Attrib))
+	}
+	return res
+}
+
+// suspicious reports whether the change time of a file changed from oldFi
+// to fi while nothing else that changes it did, like its mode or its
+// number of links, unless its content was compared according to mode.
+func suspicious(oldFi, fi *fileInfo, mode DetectMode) bool {
+	if oldFi.changeTime.IsZero() || fi.changeTime.IsZero() ||
+		oldFi.changeTime.Equal(fi.changeTime) {
+		return false
+	}
+	if mode != DetectModTime && oldFi.hash != nil && fi.hash != nil {
+		return false
+	}
+	return oldFi.mode == fi.mode && oldFi.nlink == fi.nlink && !chowned(oldFi, fi) &&
+		xattrChanges(oldFi, fi).empty()
+}
+
+// replaced reports whether oldFi and fi are different files, according
+// to their device and inode. Files without an identity are never replaced.
+func replaced(oldFi, fi *fileInfo) bool {
+	return oldFi.hasID && fi.hasID && (oldFi.dev != fi.dev || oldFi.ino != fi.ino)
+}
+
+// replacedBy looks up the identity of each replacing file of the Replace
+// events among removes. A removed file that was renamed over another one
+// is dropped from removes, and its path set in the OldPath of the event.
+func replacedBy(events []Event, removes map[string]os.FileInfo, identityKey func(os.FileInfo) (interface{}, bool)) {
+	index := make(map[interface{}]string)
+	for path, info := range removes {
+		key, ok := identityKey(info)
+		if !ok {
+			continue
+		}
+		if other, found := index[key]; !found || path < other {
+			index[key] = path
+		}
+	}
+
+	for i, e := range events {
+		if e.Op != Replace {
+			continue
+		}
+		key, ok := identityKey(e.FileInfo)
+		if !ok {
+			continue
+		}
+		if path, found := index[key]; found {
+			events[i].OldPath = path
+			delete(index, key)
+			delete(removes, path)
+		}
+	}
+}
+
+// retargeted reports whether oldFi and fi are symbolic links that point
+// to different targets.
+func retargeted(oldFi, fi *fileInfo) bool {
+	isLink := func(fi *fileInfo) bool { return fi.mode&os.ModeSymlink != 0 }
+	return isLink(oldFi) && isLink(fi) && oldFi.target != fi.target
+}
+
+// collapseMoves drops the moves of files that moved along with a moved
+// directory, keeping only the changes made to them.
+func collapseMoves(moves []Event, new Snapshot, opts CompareOptions) []Event {
+	dirs := make(map[string]string) // new paths of moved directories.
+	for _, e := range moves {
+		if e.IsDir() {
+			dirs[e.OldPath] = e.Path
+		}
+	}
+
+	var res []Event
+	for _, e := range moves {
+		if !movedWithParent(e.OldPath, e.Path, dirs) {
+			res = append(res, e)
+			continue
+		}
+		res = append(res, changes(e.Path, e.OldPath, e.FileInfo, new.Files[e.Path], opts)...)
+	}
+	return res
+}
+
+// movedWithParent reports whether oldPath moved to path because one of
+// its parent directories moved, according to dirs. Paths may use either
+// kind of separator, as snapshots of a fileSystem use slashes.
+func movedWithParent(oldPath, path string, dirs map[string]string) bool {
+	for i := len(oldPath) - 1; i > 0; i-- {
+		if oldPath[i] != '/' && oldPath[i] != os.PathSeparator {
+			continue
+		}
+		if newDir, found := dirs[oldPath[:i]]; found {
+			// The rest of the path, with its leading separator.
+			if newDir+oldPath[i:] == path {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findCopies returns the files in creates that have the same content as
+// a file in old as copies, and deletes them from creates.
+func findCopies(old Snapshot, creates map[string]os.FileInfo) []Event {
+	// Index the old files by hash, preferring the first path in order
+	// so the source of a copy doesn't depend on map iteration.
+	sources := make(map[string]string)
+	for path, info := range old.Files {
+		fi := toFileInfo(info)
+		if !fi.mode.IsRegular() || fi.hash == nil || fi.size == 0 {
+			continue
+		}
+		if source, found := sources[string(fi.hash)]; !found || path < source {
+			sources[string(fi.hash)] = path
+		}
+	}
+
+	var res []Event
+	for path, info := range creates {
+		fi := toFileInfo(info)
+		if !fi.mode.IsRegular() || fi.hash == nil || fi.size == 0 {
+			continue
+		}
+		if source, found := sources[string(fi.hash)]; found {
+			res = append(res, Event{
+				Op:       Copy,
+				Path:     path,
+				OldPath:  source,
+				FileInfo: info,
+				OldInfo:  old.Files[source],
+				NewInfo:  info,
+			})
+			delete(creates, path)
+		}
+	}
+	return res
+}
+
+// sortedPaths returns the paths of files, in order.
+func sortedPaths(files map[string]os.FileInfo) []string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
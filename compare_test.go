@@ -0,0 +1,483 @@
+package dirchanges
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+// eventStrings returns the events as sorted "OP oldpath -> path" strings.
+func eventStrings(events []Event) []string {
+	var res []string
+	for _, e := range events {
+		res = append(res, e.Op.String()+" "+e.OldPath+" -> "+e.Path)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestCompare(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Second)
+
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/d/kept":    &fileInfo{name: "kept", mode: 0644, modTime: t1},
+		"/d/written": &fileInfo{name: "written", mode: 0644, modTime: t1},
+		"/d/chmod":   &fileInfo{name: "chmod", mode: 0644, modTime: t1},
+		"/d/removed": &fileInfo{name: "removed", mode: 0644, modTime: t1},
+		"/d/renamed": &fileInfo{name: "renamed", size: 3, mode: 0600, modTime: t1, dev: 1, ino: 7, hasID: true},
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/d/kept":    &fileInfo{name: "kept", mode: 0644, modTime: t1},
+		"/d/written": &fileInfo{name: "written", mode: 0644, modTime: t2},
+		"/d/chmod":   &fileInfo{name: "chmod", mode: 0755, modTime: t1},
+		"/d/created": &fileInfo{name: "created", mode: 0644, modTime: t2},
+		"/d/new":     &fileInfo{name: "new", size: 3, mode: 0600, modTime: t1, dev: 1, ino: 7, hasID: true},
+	}}
+
+	expected := []string{
+		"CHMOD /d/chmod -> /d/chmod",
+		"CREATE  -> /d/created",
+		"REMOVE /d/removed -> /d/removed",
+		"RENAME /d/renamed -> /d/new",
+		"WRITE /d/written -> /d/written",
+	}
+	got := eventStrings(Compare(old, new))
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], got[i])
+		}
+	}
+
+	// Comparing a snapshot with itself yields nothing.
+	if events := Compare(new, new); len(events) != 0 {
+		t.Errorf("expected no events, got %v", events)
+	}
+}
+
+func TestScanKeepsBaseline(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+	before := w.Snapshot()
+
+	newFile := filepath.Join(testDir, "newfile.txt")
+	if err := ioutil.WriteFile(newFile, []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := w.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := after.Files[newFile]; !found {
+		t.Errorf("expected to find %s in the scan", newFile)
+	}
+	if _, found := w.files[newFile]; found {
+		t.Errorf("expected Scan to not change the baseline")
+	}
+
+	// Any two snapshots can be compared, without a Watcher.
+	var created bool
+	for _, event := range Compare(before, after) {
+		if event.Op == Create && event.Path == newFile {
+			created = true
+		}
+	}
+	if !created {
+		t.Errorf("expected a create event for %s", newFile)
+	}
+}
+
+func TestCompareTypeChange(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Second)
+
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/d/a": &fileInfo{name: "a", mode: 0644, modTime: t1},
+		"/d/b": &fileInfo{name: "b", mode: os.ModeDir | 0755, modTime: t1, dir: true},
+		"/d/c": &fileInfo{name: "c", mode: 0644, modTime: t1},
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/d/a": &fileInfo{name: "a", mode: os.ModeDir | 0755, modTime: t2, dir: true},
+		"/d/b": &fileInfo{name: "b", mode: os.ModeSymlink | 0777, modTime: t2},
+		"/d/c": &fileInfo{name: "c", mode: os.ModeNamedPipe | 0644, modTime: t1},
+	}}
+
+	expected := map[string][2]FileType{
+		"/d/a": {TypeRegular, TypeDir},
+		"/d/b": {TypeDir, TypeSymlink},
+		"/d/c": {TypeRegular, TypeNamedPipe},
+	}
+	events := Compare(old, new)
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %v", len(expected), eventStrings(events))
+	}
+	for _, e := range events {
+		types := expected[e.Path]
+		if e.Op != TypeChange || e.OldType != types[0] || e.Type != types[1] {
+			t.Errorf("expected %s to change from %s to %s, got %s %s -> %s",
+				e.Path, types[0], types[1], e.Op, e.OldType, e.Type)
+		}
+	}
+}
+
+func TestCompareCollapseMoves(t *testing.T) {
+	// Without file identities, moves can't be told apart on windows.
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Second)
+	file := func(name string, ino uint64, modTime time.Time) *fileInfo {
+		return &fileInfo{name: name, mode: 0644, modTime: modTime, dev: 1, ino: ino, hasID: true}
+	}
+	dir := func(name string, ino uint64) *fileInfo {
+		return &fileInfo{name: name, mode: os.ModeDir | 0755, modTime: t1, dir: true, dev: 1, ino: ino, hasID: true}
+	}
+
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/d/a":     dir("a", 1),
+		"/d/a/x":   file("x", 2, t1),
+		"/d/a/s":   dir("s", 3),
+		"/d/a/s/y": file("y", 4, t1),
+		"/d/a/z":   file("z", 5, t1),
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/e/b":     dir("b", 1),
+		"/e/b/x":   file("x", 2, t2),
+		"/e/b/s":   dir("s", 3),
+		"/e/b/s/y": file("y", 4, t1),
+		"/e/z":     file("z", 5, t1),
+	}}
+
+	testCases := []struct {
+		opts     CompareOptions
+		expected []string
+	}{
+		{CompareOptions{}, []string{
+			"MOVE /d/a -> /e/b",
+			"MOVE /d/a/s -> /e/b/s",
+			"MOVE /d/a/s/y -> /e/b/s/y",
+			"MOVE /d/a/x -> /e/b/x",
+			"MOVE /d/a/z -> /e/z",
+		}},
+		{CompareOptions{CollapseMoves: true}, []string{
+			"MOVE /d/a -> /e/b",
+			"MOVE /d/a/z -> /e/z",
+			"WRITE /d/a/x -> /e/b/x",
+		}},
+	}
+
+	for _, tc := range testCases {
+		got := eventStrings(CompareWith(old, new, tc.opts))
+		if len(got) != len(tc.expected) {
+			t.Errorf("expected %v, got %v", tc.expected, got)
+			continue
+		}
+		for i := range tc.expected {
+			if got[i] != tc.expected[i] {
+				t.Errorf("expected %s, got %s", tc.expected[i], got[i])
+			}
+		}
+	}
+}
+
+func TestCompareIdentityKey(t *testing.T) {
+	old := Snapshot{Files: map[string]os.FileInfo{}}
+	new := Snapshot{Files: map[string]os.FileInfo{}}
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("file_%d", i)
+		old.Files["/a/"+name] = &fileInfo{name: name, size: int64(i)}
+		new.Files["/b/"+name] = &fileInfo{name: name, size: int64(i)}
+	}
+
+	opts := CompareOptions{
+		IdentityKey: func(info os.FileInfo) (interface{}, bool) {
+			return info.Name(), true
+		},
+	}
+	events := CompareWith(old, new, opts)
+	if len(events) != 1000 {
+		t.Fatalf("expected 1000 events, got %d", len(events))
+	}
+	for _, e := range events {
+		if e.Op != Move || filepath.Base(e.OldPath) != filepath.Base(e.Path) {
+			t.Errorf("expected a move to the same name, got %s %s -> %s", e.Op, e.OldPath, e.Path)
+		}
+	}
+}
+
+func TestCompareIdentityOrder(t *testing.T) {
+	old := Snapshot{Files: map[string]os.FileInfo{}}
+	new := Snapshot{Files: map[string]os.FileInfo{}}
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("file_%d", i)
+		old.Files["/a/"+name] = &fileInfo{name: name}
+		new.Files["/b/"+name] = &fileInfo{name: name}
+	}
+
+	// All the files share an identity, like hard links do, so they are
+	// paired in order.
+	opts := CompareOptions{
+		IdentityKey: func(info os.FileInfo) (interface{}, bool) {
+			return 0, true
+		},
+	}
+	for run := 0; run < 10; run++ {
+		for _, e := range CompareWith(old, new, opts) {
+			if filepath.Base(e.OldPath) != filepath.Base(e.Path) {
+				t.Fatalf("expected a move to the same name, got %s -> %s", e.OldPath, e.Path)
+			}
+		}
+	}
+}
+
+func TestCompareCopies(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	file := func(name, hash string, size int64) *fileInfo {
+		return &fileInfo{name: name, size: size, mode: 0644, modTime: t1, hash: []byte(hash)}
+	}
+
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/d/a":     file("a", "content", 7),
+		"/d/b":     file("b", "content", 7),
+		"/d/empty": file("empty", "nothing", 0),
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/d/a":      file("a", "content", 7),
+		"/d/empty":  file("empty", "nothing", 0),
+		"/d/c":      file("c", "content", 7),
+		"/d/other":  file("other", "other", 5),
+		"/d/empty2": file("empty2", "nothing", 0),
+	}}
+
+	testCases := []struct {
+		opts     CompareOptions
+		expected []string
+	}{
+		{CompareOptions{}, []string{
+			"CREATE  -> /d/c",
+			"CREATE  -> /d/empty2",
+			"CREATE  -> /d/other",
+			"REMOVE /d/b -> /d/b",
+		}},
+		// The source of a copy is the first of the files with its content.
+		{CompareOptions{DetectCopies: true}, []string{
+			"COPY /d/a -> /d/c",
+			"CREATE  -> /d/empty2",
+			"CREATE  -> /d/other",
+			"REMOVE /d/b -> /d/b",
+		}},
+	}
+
+	for _, tc := range testCases {
+		got := eventStrings(CompareWith(old, new, tc.opts))
+		if len(got) != len(tc.expected) {
+			t.Errorf("expected %v, got %v", tc.expected, got)
+			continue
+		}
+		for i := range tc.expected {
+			if got[i] != tc.expected[i] {
+				t.Errorf("expected %s, got %s", tc.expected[i], got[i])
+			}
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	// Without file identities, replaced files can't be told apart on windows.
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	w.FilterOps(Replace, Remove, Write)
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Save file.txt like an editor, keeping its modification time.
+	target := filepath.Join(testDir, "file.txt")
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	temp := filepath.Join(testDir, "file.txt~")
+	if err := ioutil.WriteFile(temp, []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(temp, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(temp, target); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rename a watched file over another one with the same modification
+	// time, so the replaced file isn't also reported written.
+	info, err = os.Stat(filepath.Join(testDir, "file_2.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(testDir, "file_1.txt"), info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(testDir, "file_1.txt"), filepath.Join(testDir, "file_2.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"WRITE " + testDir + " -> " + testDir,
+		"REPLACE " + target + " -> " + target,
+		"REPLACE " + filepath.Join(testDir, "file_1.txt") + " -> " + filepath.Join(testDir, "file_2.txt"),
+	}
+	sort.Strings(expected)
+	got := eventStrings(diff)
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], got[i])
+		}
+	}
+}
+
+func TestCompareReplaced(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	file := func(ino uint64, modTime time.Time, mode os.FileMode) *fileInfo {
+		return &fileInfo{name: "f", mode: mode, modTime: modTime, hasID: true, ino: ino}
+	}
+
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/d/saved":   file(1, t1, 0644),
+		"/d/same":    file(2, t1, 0644),
+		"/d/chmoded": file(3, t1, 0644),
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/d/saved":   file(4, t1.Add(time.Second), 0644),
+		"/d/same":    file(5, t1, 0644),
+		"/d/chmoded": file(6, t1, 0600),
+	}}
+
+	// How the content and mode of a replaced file changed is reported too.
+	expected := []string{
+		"CHMOD /d/chmoded -> /d/chmoded",
+		"REPLACE /d/chmoded -> /d/chmoded",
+		"REPLACE /d/same -> /d/same",
+		"REPLACE /d/saved -> /d/saved",
+		"WRITE /d/saved -> /d/saved",
+	}
+	if got := eventStrings(Compare(old, new)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestCompareInfos(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Second)
+
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/d/grown":   &fileInfo{name: "grown", size: 10, mode: 0644, modTime: t1},
+		"/d/removed": &fileInfo{name: "removed", size: 4, mode: 0644, modTime: t1},
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/d/grown":   &fileInfo{name: "grown", size: 25, mode: 0755, modTime: t2},
+		"/d/created": &fileInfo{name: "created", size: 3, mode: 0644, modTime: t2},
+	}}
+
+	testCases := map[string]struct {
+		delta int64
+		mode  os.FileMode
+	}{
+		"WRITE /d/grown":    {15, 0111},
+		"CHMOD /d/grown":    {15, 0111},
+		"CREATE /d/created": {3, 0},
+		"REMOVE /d/removed": {-4, 0},
+	}
+	events := Compare(old, new)
+	if len(events) != len(testCases) {
+		t.Fatalf("expected %d events, got %v", len(testCases), eventStrings(events))
+	}
+	for _, e := range events {
+		tc := testCases[e.Op.String()+" "+e.Path]
+		if e.SizeDelta() != tc.delta {
+			t.Errorf("expected %s %s to grow by %d, got %d", e.Op, e.Path, tc.delta, e.SizeDelta())
+		}
+		if e.ModeChanges() != tc.mode {
+			t.Errorf("expected %s %s to change mode bits %s, got %s", e.Op, e.Path, tc.mode, e.ModeChanges())
+		}
+		if (e.Op == Create) != (e.OldInfo == nil) || (e.Op == Remove) != (e.NewInfo == nil) {
+			t.Errorf("expected %s %s to have old and new infos where they exist", e.Op, e.Path)
+		}
+	}
+}
+
+func TestCompareDevices(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	device := func(name string, major, minor uint32) *fileInfo {
+		return &fileInfo{name: name, mode: os.ModeDevice | os.ModeCharDevice | 0666, modTime: t1,
+			rdev: DeviceNumber{major, minor}}
+	}
+
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/dev/null":    device("null", 1, 3),
+		"/dev/zero":    device("zero", 1, 5),
+		"/dev/log":     &fileInfo{name: "log", mode: os.ModeSocket | 0666, modTime: t1},
+		"/dev/initctl": &fileInfo{name: "initctl", mode: os.ModeNamedPipe | 0600, modTime: t1},
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/dev/null":    device("null", 1, 3),
+		"/dev/zero":    device("zero", 1, 7),
+		"/dev/initctl": &fileInfo{name: "initctl", mode: os.ModeNamedPipe | 0600, modTime: t1},
+		"/dev/tty":     device("tty", 5, 0),
+	}}
+
+	expected := map[string]Event{
+		"/dev/zero": {Op: DeviceChange, OldType: TypeCharDevice, Type: TypeCharDevice,
+			OldDevice: DeviceNumber{1, 5}, Device: DeviceNumber{1, 7}},
+		"/dev/log": {Op: Remove, OldType: TypeSocket, Type: TypeSocket},
+		"/dev/tty": {Op: Create, Type: TypeCharDevice, Device: DeviceNumber{5, 0}},
+	}
+	events := Compare(old, new)
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %v", len(expected), eventStrings(events))
+	}
+	for _, e := range events {
+		ex := expected[e.Path]
+		if e.Op != ex.Op || e.OldType != ex.OldType || e.Type != ex.Type ||
+			e.OldDevice != ex.OldDevice || e.Device != ex.Device {
+			t.Errorf("expected %s %s %s -> %s %s -> %s, got %s %s -> %s %s -> %s", e.Path,
+				ex.Op, ex.OldType, ex.Type, ex.OldDevice, ex.Device,
+				e.Op, e.OldType, e.Type, e.OldDevice, e.Device)
+		}
+	}
+
+	// Sockets coming and going can be left out.
+	types := map[FileType]struct{}{TypeCharDevice: {}, TypeDevice: {}}
+	if filtered := filterTypes(events, types); len(filtered) != 2 {
+		t.Errorf("expected only the devices, got %v", eventStrings(filtered))
+	}
+}
@@ -0,0 +1,128 @@
+package dirchanges
+
+import (
+	"fmt"
+	"os"
+)
+
+// A FileType is the type of a file, as told by its mode.
+type FileType uint32
+
+// File types
+const (
+	TypeRegular FileType = iota
+	TypeDir
+	TypeSymlink
+	TypeNamedPipe
+	TypeSocket
+	TypeDevice
+	TypeCharDevice
+	TypeIrregular
+)
+
+var fileTypes = map[FileType]string{
+	TypeRegular:    "REGULAR",
+	TypeDir:        "DIR",
+	TypeSymlink:    "SYMLINK",
+	TypeNamedPipe:  "FIFO",
+	TypeSocket:     "SOCKET",
+	TypeDevice:     "DEVICE",
+	TypeCharDevice: "CHARDEVICE",
+	TypeIrregular:  "IRREGULAR",
+}
+
+// String prints the string version of the FileType consts
+func (t FileType) String() string {
+	if fileType, found := fileTypes[t]; found {
+		return fileType
+	}
+	return "???"
+}
+
+// fileTypeOf returns the type of a file with the given mode.
+func fileTypeOf(mode os.FileMode) FileType {
+	switch {
+	case mode.IsRegular():
+		return TypeRegular
+	case mode&os.ModeDir != 0:
+		return TypeDir
+	case mode&os.ModeSymlink != 0:
+		return TypeSymlink
+	case mode&os.ModeNamedPipe != 0:
+		return TypeNamedPipe
+	case mode&os.ModeSocket != 0:
+		return TypeSocket
+	case mode&os.ModeCharDevice != 0:
+		return TypeCharDevice
+	case mode&os.ModeDevice != 0:
+		return TypeDevice
+	}
+	return TypeIrregular
+}
+
+// A DeviceNumber is what a device file stands for, as its major and
+// minor numbers.
+type DeviceNumber struct {
+	Major uint32
+	Minor uint32
+}
+
+// String prints d as "major:minor".
+func (d DeviceNumber) String() string {
+	return fmt.Sprintf("%d:%d", d.Major, d.Minor)
+}
+
+// isDevice reports whether fi is a block or character device.
+func isDevice(fi *fileInfo) bool {
+	return fi.mode&os.ModeDevice != 0
+}
+
+// deviceChanged reports whether oldFi and fi are devices that stand for
+// different devices.
+func deviceChanged(oldFi, fi *fileInfo) bool {
+	return isDevice(oldFi) && isDevice(fi) && oldFi.rdev != fi.rdev
+}
+
+// FilterTypes filters which events should be returned by the type of
+// the file, before or after the event. For instance, FilterTypes with
+// every type but TypeSocket hides sockets coming and going.
+func (w *Watcher) FilterTypes(types ...FileType) {
+	w.types = make(map[FileType]struct{})
+	for _, t := range types {
+		w.types[t] = struct{}{}
+	}
+}
+
+// filterTypes returns the events about files of one of types.
+func filterTypes(events []Event, types map[FileType]struct{}) []Event {
+	var res []Event
+	for _, e := range events {
+		_, found := types[e.Type]
+		if !found && e.OldInfo != nil {
+			_, found = types[e.OldType]
+		}
+		if found {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// describeTypes sets the types of the file before and after e, and the
+// device numbers of devices.
+func describeTypes(e *Event) {
+	if e.OldInfo != nil {
+		oldFi := toFileInfo(e.OldInfo)
+		e.OldType = fileTypeOf(oldFi.mode)
+		e.OldDevice = oldFi.rdev
+	}
+	info := e.NewInfo
+	if info == nil {
+		info = e.OldInfo
+	}
+	if info != nil {
+		fi := toFileInfo(info)
+		e.Type = fileTypeOf(fi.mode)
+		e.Device = fi.rdev
+	}
+}
@@ -0,0 +1,174 @@
+package dirchanges
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// fileSystem is the file tree a Watcher lists files from.
+type fileSystem interface {
+	// Stat and Lstat return the info of the named file, following
+	// symbolic links or not.
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	// ReadDir returns the Lstat info of the directory's entries.
+	ReadDir(name string) ([]os.FileInfo, error)
+	Open(name string) (io.ReadCloser, error)
+	Readlink(name string) (string, error)
+	// EvalSymlinks returns name after resolving all symbolic links.
+	EvalSymlinks(name string) (string, error)
+
+	// Abs returns the canonical form of name, as used in snapshots.
+	Abs(name string) (string, error)
+	Join(elem ...string) string
+	Dir(name string) string
+	IsHidden(name string) (bool, error)
+	// Within reports whether name is dir or inside of it.
+	Within(dir, name string) bool
+}
+
+// osFileSystem is the file system of the operating system, with
+// absolute paths.
+type osFileSystem struct{}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error)      { return os.Stat(name) }
+func (osFileSystem) Lstat(name string) (os.FileInfo, error)     { return os.Lstat(name) }
+func (osFileSystem) ReadDir(name string) ([]os.FileInfo, error) { return ioutil.ReadDir(name) }
+func (osFileSystem) Open(name string) (io.ReadCloser, error)    { return openFile(name) }
+func (osFileSystem) Readlink(name string) (string, error)       { return os.Readlink(name) }
+func (osFileSystem) EvalSymlinks(name string) (string, error)   { return filepath.EvalSymlinks(name) }
+func (osFileSystem) Abs(name string) (string, error)            { return filepath.Abs(name) }
+func (osFileSystem) Join(elem ...string) string                 { return filepath.Join(elem...) }
+func (osFileSystem) Dir(name string) string                     { return filepath.Dir(name) }
+func (osFileSystem) IsHidden(name string) (bool, error)         { return isHiddenFile(name) }
+
+func (osFileSystem) Within(dir, name string) bool {
+	if name == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(name, dir)
+}
+
+// ioFileSystem adapts an fs.FS, with slash separated paths relative to
+// its root, as described by fs.ValidPath.
+type ioFileSystem struct {
+	fsys fs.FS
+}
+
+// lstatFS is implemented by file systems that can stat a symbolic link
+// without following it.
+type lstatFS interface {
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// readLinkFS is implemented by file systems that can read the target of a
+// symbolic link.
+type readLinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// errTooManyLinks is returned when resolving a path takes too many
+// symbolic links, which likely form a loop.
+var errTooManyLinks = errors.New("too many levels of symbolic links")
+
+func (f ioFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.Stat(f.fsys, name)
+}
+
+func (f ioFileSystem) Lstat(name string) (os.FileInfo, error) {
+	if fsys, ok := f.fsys.(lstatFS); ok {
+		return fsys.Lstat(name)
+	}
+	return fs.Stat(f.fsys, name)
+}
+
+func (f ioFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := fs.ReadDir(f.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (f ioFileSystem) Open(name string) (io.ReadCloser, error) {
+	return f.fsys.Open(name)
+}
+
+func (f ioFileSystem) Readlink(name string) (string, error) {
+	if fsys, ok := f.fsys.(readLinkFS); ok {
+		return fsys.ReadLink(name)
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+}
+
+func (f ioFileSystem) EvalSymlinks(name string) (string, error) {
+	resolved := "."
+	parts := strings.Split(name, "/")
+	for links := 0; len(parts) > 0; {
+		next := path.Join(resolved, parts[0])
+		parts = parts[1:]
+
+		info, err := f.Lstat(next)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if links++; links > 255 {
+			return "", &fs.PathError{Op: "evalsymlinks", Path: name, Err: errTooManyLinks}
+		}
+		target, err := f.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		// Start over from the root with the target and what's left.
+		if !path.IsAbs(target) {
+			target = path.Join(resolved, target)
+		}
+		if !fs.ValidPath(target) {
+			return "", &fs.PathError{Op: "evalsymlinks", Path: name, Err: fs.ErrNotExist}
+		}
+		resolved = "."
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	return resolved, nil
+}
+
+func (f ioFileSystem) Abs(name string) (string, error) {
+	name = path.Clean(filepath.ToSlash(name))
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "abs", Path: name, Err: fs.ErrInvalid}
+	}
+	return name, nil
+}
+
+func (ioFileSystem) Join(elem ...string) string { return path.Join(elem...) }
+func (ioFileSystem) Dir(name string) string     { return path.Dir(name) }
+
+func (ioFileSystem) IsHidden(name string) (bool, error) {
+	return name != "." && strings.HasPrefix(path.Base(name), "."), nil
+}
+
+func (ioFileSystem) Within(dir, name string) bool {
+	return dir == "." || name == dir || strings.HasPrefix(name, dir+"/")
+}
@@ -0,0 +1,97 @@
+package dirchanges
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestWatcherFS(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a/file.txt":         {Data: []byte("a"), ModTime: t1},
+		"a/renamed.txt":      {Data: []byte("r"), ModTime: t1},
+		"a/removed.txt":      {Data: []byte("x"), ModTime: t1},
+		"a/.hidden":          {Data: []byte("h"), ModTime: t1},
+		"a/sub/deep.txt":     {Data: []byte("d"), ModTime: t1},
+		"outside/ignore.txt": {Data: []byte("o"), ModTime: t1},
+	}
+
+	w := NewFS(fsys)
+	w.IgnoreHiddenFiles(true)
+
+	if err := w.Add("/a"); err == nil {
+		t.Error("expected an error for a rooted path")
+	}
+	if err := w.AddRecursive("a"); err != nil {
+		t.Fatal(err)
+	}
+	// a, a/sub and three files in a and one in a/sub.
+	if len(w.files) != 6 {
+		t.Errorf("expected 6 files, found %d", len(w.files))
+	}
+	if _, found := w.files["a/sub/deep.txt"]; !found {
+		t.Errorf("expected to find a/sub/deep.txt")
+	}
+
+	fsys["a/file.txt"] = &fstest.MapFile{Data: []byte("b"), ModTime: t1.Add(time.Second)}
+	fsys["a/new.txt"] = fsys["a/renamed.txt"]
+	delete(fsys, "a/renamed.txt")
+	delete(fsys, "a/removed.txt")
+
+	diff, err := w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// MapFS has no file identity, so the rename is a remove and a create.
+	expected := []string{
+		"CREATE  -> a/new.txt",
+		"REMOVE a/removed.txt -> a/removed.txt",
+		"REMOVE a/renamed.txt -> a/renamed.txt",
+		"WRITE a/file.txt -> a/file.txt",
+	}
+	got := eventStrings(diff)
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], got[i])
+		}
+	}
+}
+
+func TestWatcherDirFS(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := NewFS(os.DirFS(testDir))
+	if err := w.AddRecursive("."); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.files) != 8 {
+		t.Errorf("expected 8 files, found %d", len(w.files))
+	}
+
+	err := os.Rename(filepath.Join(testDir, "file.txt"), filepath.Join(testDir, "renamed.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.FilterOps(Rename)
+	diff, err := w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 1 || diff[0].OldPath != "file.txt" || diff[0].Path != "renamed.txt" {
+		t.Errorf("expected rename of file.txt to renamed.txt, got %v", diff)
+	}
+}
@@ -0,0 +1,202 @@
+package dirchanges
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// gitignoreFile is the name of the files that IgnoreGitignoreFiles reads.
+const gitignoreFile = ".gitignore"
+
+// gitignorePattern is a single line of a .gitignore file.
+type gitignorePattern struct {
+	segments []string // slash separated parts of the pattern.
+	negate   bool     // pattern started with "!".
+	dirOnly  bool     // pattern ended with "/".
+	anchored bool     // pattern contained a "/" before its end.
+}
+
+// parseGitignorePattern parses line in gitignore syntax. It returns false
+// if line is blank or a comment.
+func parseGitignorePattern(line string) (gitignorePattern, bool, error) {
+	var p gitignorePattern
+
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false, nil
+	}
+
+	// Trailing spaces are ignored unless they are escaped.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return p, false, nil
+	}
+
+	p.segments = strings.Split(line, "/")
+	for i, segment := range p.segments {
+		// Git spells a negated character class [!...].
+		segment = strings.Replace(segment, "[!", "[^", -1)
+		if _, err := path.Match(segment, ""); err != nil {
+			return p, false, err
+		}
+		p.segments[i] = segment
+	}
+	return p, true, nil
+}
+
+// match reports whether the slash separated path rel, relative to the
+// directory of the pattern, matches p.
+func (p gitignorePattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if !p.anchored {
+		ok, _ := path.Match(p.segments[0], path.Base(rel))
+		return ok
+	}
+	return matchSegments(p.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches path parts against pattern segments, where a "**"
+// segment matches any number of parts, and a trailing "**" at least one.
+func matchSegments(segments, parts []string) bool {
+	for len(segments) > 0 {
+		if segments[0] == "**" {
+			if len(segments) == 1 {
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(segments[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(segments[0], parts[0]); !ok {
+			return false
+		}
+		segments, parts = segments[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// gitignore is a list of patterns that apply to a directory and the
+// directories below it. Patterns of deeper directories take precedence
+// over the ones of their parents.
+type gitignore struct {
+	parent   *gitignore
+	base     string // slash separated directory, relative to the watched name.
+	patterns []gitignorePattern
+}
+
+// ignored reports whether the slash separated path rel, relative to the
+// watched name, is ignored.
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	for ; g != nil; g = g.parent {
+		relToBase := rel
+		if g.base != "" {
+			relToBase = strings.TrimPrefix(rel, g.base+"/")
+		}
+		// The last matching pattern decides.
+		for i := len(g.patterns) - 1; i >= 0; i-- {
+			p := g.patterns[i]
+			if p.match(relToBase, isDir) {
+				return !p.negate
+			}
+		}
+	}
+	return false
+}
+
+// IgnorePatterns adds patterns in gitignore syntax, such as "*.o",
+// "/build/" or "!keep.o", for files that should be ignored. Patterns are
+// relative to each watched name and have a lower precedence than the ones
+// read from .gitignore files.
+//
+// Unlike Ignore, IgnorePatterns does not remove files that are already
+// added, so it should be called before adding them.
+func (w *Watcher) IgnorePatterns(patterns ...string) error {
+	for _, line := range patterns {
+		p, ok, err := parseGitignorePattern(line)
+		if err != nil {
+			return err
+		}
+		if ok {
+			w.patterns = append(w.patterns, p)
+		}
+	}
+	w.scanned = nil
+	return nil
+}
+
+// IgnoreGitignoreFiles sets the watcher to ignore files matched by the
+// .gitignore files found in watched directories, scoped to the directory
+// they are in, the way git does.
+func (w *Watcher) IgnoreGitignoreFiles(ignore bool) {
+	w.gitignoreFiles = ignore
+	w.scanned = nil
+}
+
+// rootGitignore returns the patterns that apply to the watched name.
+func (w *Watcher) rootGitignore(name string) (*gitignore, error) {
+	var g *gitignore
+	if len(w.patterns) > 0 {
+		g = &gitignore{patterns: w.patterns}
+	}
+	return w.dirGitignore(g, name, "")
+}
+
+// dirGitignore returns the patterns that apply to the directory dir,
+// found at rel relative to the watched name, given the patterns of its
+// parent.
+func (w *Watcher) dirGitignore(parent *gitignore, dir, rel string) (*gitignore, error) {
+	if !w.gitignoreFiles {
+		return parent, nil
+	}
+
+	f, err := w.fs.Open(w.fs.Join(dir, gitignoreFile))
+	if os.IsNotExist(err) {
+		return parent, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &gitignore{parent: parent, base: rel}
+	for _, line := range strings.Split(string(data), "\n") {
+		// Like git, skip invalid patterns.
+		if p, ok, err := parseGitignorePattern(line); ok && err == nil {
+			g.patterns = append(g.patterns, p)
+		}
+	}
+	if len(g.patterns) == 0 {
+		return parent, nil
+	}
+	return g, nil
+}
@@ -0,0 +1,95 @@
+package dirchanges
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestGitignorePattern(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		rel     string
+		isDir   bool
+		matches bool
+	}{
+		{"*.o", "main.o", false, true},
+		{"*.o", "a/b/main.o", false, true},
+		{"*.o", "main.c", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "a/build", true, true},
+		{"/build", "build", false, true},
+		{"/build", "a/build", false, false},
+		{"a/b", "a/b", false, true},
+		{"a/b", "x/a/b", false, false},
+		{"**/foo", "foo", false, true},
+		{"**/foo", "a/b/foo", false, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**", "a", true, false},
+		{"a/**", "a/x/y", false, true},
+		{"[!a]*", "abc", false, false},
+		{"[!a]*", "bcd", false, true},
+		{"trailing  ", "trailing", false, true},
+	}
+
+	for _, tc := range testCases {
+		p, ok, err := parseGitignorePattern(tc.pattern)
+		if err != nil || !ok {
+			t.Errorf("expected %q to parse, got %t, %v", tc.pattern, ok, err)
+			continue
+		}
+		if p.match(tc.rel, tc.isDir) != tc.matches {
+			t.Errorf("expected %q matching %q to be %t", tc.pattern, tc.rel, tc.matches)
+		}
+	}
+
+	for _, line := range []string{"", "# comment", "/"} {
+		if _, ok, _ := parseGitignorePattern(line); ok {
+			t.Errorf("expected %q to not be a pattern", line)
+		}
+	}
+	if _, _, err := parseGitignorePattern("[a"); err == nil {
+		t.Errorf("expected an error for a malformed pattern")
+	}
+}
+
+func TestIgnoreGitignoreFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		".gitignore":            {Data: []byte("*.o\n!keep.o\nnode_modules/\n")},
+		"main.c":                {},
+		"main.o":                {},
+		"keep.o":                {},
+		"node_modules/x/y.js":   {},
+		"sub/.gitignore":        {Data: []byte("/local.txt\n!*.o\n")},
+		"sub/local.txt":         {},
+		"sub/deeper/local.txt":  {},
+		"sub/lib.o":             {},
+		"other/local.txt":       {},
+		"vendor/anything.txt":   {},
+		"vendor/sub/vendor.txt": {},
+	}
+
+	w := NewFS(fsys)
+	w.IgnoreGitignoreFiles(true)
+	if err := w.IgnorePatterns("/vendor/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddRecursive("."); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		".", ".gitignore", "main.c", "keep.o",
+		"sub", "sub/.gitignore", "sub/deeper", "sub/deeper/local.txt", "sub/lib.o",
+		"other", "other/local.txt",
+	}
+	for _, path := range expected {
+		if _, found := w.files[path]; !found {
+			t.Errorf("expected to find %s", path)
+		}
+	}
+	if len(w.files) != len(expected) {
+		t.Errorf("expected %d files, found %d: %v", len(expected), len(w.files), w.files)
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/karelbilek/dirchanges
 
-go 1.14
+go 1.16
@@ -0,0 +1,201 @@
+package dirchanges
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"time"
+)
+
+// A DetectMode describes how a Watcher decides that a file was written.
+type DetectMode uint32
+
+// Detect modes
+const (
+	// DetectModTime reports a Write when the modification time of a
+	// file changed. It is the default.
+	DetectModTime DetectMode = iota
+	// DetectContent hashes every file and reports a Write only when
+	// the content of a file changed.
+	DetectContent
+	// DetectHybrid hashes a file only when its size or modification
+	// time changed, and reports a Write only when the content changed.
+	// Edits that keep both the size and the modification time are missed.
+	DetectHybrid
+)
+
+var detectModes = map[DetectMode]string{
+	DetectModTime: "MODTIME",
+	DetectContent: "CONTENT",
+	DetectHybrid:  "HYBRID",
+}
+
+// String prints the string version of the DetectMode consts
+func (m DetectMode) String() string {
+	if mode, found := detectModes[m]; found {
+		return mode
+	}
+	return "???"
+}
+
+// SetDetectMode sets how the watcher decides that a file was written.
+// It is the same as setting CompareOptions.Detect.
+//
+// The mode should be set before files are added, as only files that
+// were hashed when added can be compared by content. Directories are
+// always compared by modification time.
+func (w *Watcher) SetDetectMode(mode DetectMode) {
+	w.compare.Detect = mode
+	w.scanned = nil
+}
+
+// needsContent reports whether the watcher needs to read the content of
+// files, to hash them or compute their signature.
+func (w *Watcher) needsContent() bool {
+	return w.compare.Detect != DetectModTime || w.compare.RenameSimilarity > 0 ||
+		w.compare.DetectCopies
+}
+
+// hashFiles stores the content hash of every regular file in files, and
+// its signature if needed, unless the watcher doesn't need them. Files
+// whose entry in old is racy are hashed regardless, to be verified.
+//
+// Except in DetectContent mode, files whose size and modification time
+// match their entry in old reuse what was recorded there, unless it's
+// racy. Files that are gone since they were listed are dropped from
+// files.
+func (w *Watcher) hashFiles(files, old map[string]os.FileInfo) error {
+	content := w.needsContent()
+	signed := w.compare.RenameSimilarity > 0
+	opts := w.compareOptions()
+
+	todo := make(map[string]*fileInfo)
+	for path, info := range files {
+		fi := toFileInfo(info)
+		if !fi.mode.IsRegular() {
+			continue
+		}
+		var oldFi *fileInfo
+		if oldInfo, found := old[path]; found {
+			oldFi = toFileInfo(oldInfo)
+		}
+		racy := oldFi != nil && oldFi.racy && oldFi.hash != nil
+		if !content && !racy {
+			continue
+		}
+		files[path] = fi
+
+		if w.compare.Detect != DetectContent && oldFi != nil && !racy {
+			hasSig := oldFi.sig != nil || !signed || oldFi.size > maxSignedSize
+			ctimeChanged := w.compare.SuspectCtime && !oldFi.changeTime.Equal(fi.changeTime)
+			if oldFi.hash != nil && hasSig && !ctimeChanged &&
+				oldFi.size == fi.size &&
+				sameModTime(oldFi.modTime, fi.modTime, opts.precisionOf(path)) {
+				fi.hash, fi.sig = oldFi.hash, oldFi.sig
+				continue
+			}
+		}
+
+		todo[path] = fi
+	}
+	// Files only hashed to verify racy entries can be left unhashed.
+	gone, err := w.hashAll(todo, signed, !content)
+	for _, path := range gone {
+		delete(files, path)
+	}
+	return err
+}
+
+// hashAll stores the content hash of each of files, and their signature
+// if signed is set, using up to w.workers goroutines. It returns the
+// paths of the files that are gone since they were listed, which are
+// left unhashed. With lenient set, files that can't be read are left
+// unhashed too.
+func (w *Watcher) hashAll(files map[string]*fileInfo, signed, lenient bool) ([]string, error) {
+	type result struct {
+		path string
+		err  error
+	}
+	paths := make(chan string)
+	results := make(chan result)
+
+	workers := w.workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for path := range paths {
+				// Each worker hashes different files.
+				err := hashFile(w.fs, path, files[path], signed)
+				if lenient && os.IsPermission(err) {
+					err = nil
+				}
+				results <- result{path, err}
+			}
+		}()
+	}
+
+	go func() {
+		for path := range files {
+			paths <- path
+		}
+		close(paths)
+	}()
+
+	var gone []string
+	var err error
+	for range files {
+		r := <-results
+		switch {
+		case os.IsNotExist(r.err):
+			gone = append(gone, r.path)
+		case r.err != nil && err == nil:
+			err = r.err
+		}
+	}
+	return gone, err
+}
+
+// hashFile stores the SHA-256 hash of the named file's content in fi,
+// and its signature if signed is set.
+func hashFile(fsys fileSystem, name string, fi *fileInfo, signed bool) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	var dst io.Writer = h
+	var s *signer
+	if signed && fi.size <= maxSignedSize {
+		s = newSigner()
+		dst = io.MultiWriter(h, s)
+	}
+	if _, err := io.Copy(dst, f); err != nil {
+		return err
+	}
+
+	fi.hash = h.Sum(nil)
+	if s != nil {
+		fi.sig = s.signature()
+	}
+	return nil
+}
+
+// written reports whether a file changed from oldFi to fi. Files are
+// compared by content when mode says so and both were hashed, and by
+// modification time, to precision, otherwise. A racy file is also
+// compared by content when both were hashed.
+func written(oldFi, fi *fileInfo, mode DetectMode, precision time.Duration) bool {
+	hashed := oldFi.hash != nil && fi.hash != nil
+	if mode == DetectModTime || !hashed {
+		if !sameModTime(oldFi.modTime, fi.modTime, precision) {
+			return true
+		}
+		return oldFi.racy && hashed && !bytes.Equal(oldFi.hash, fi.hash)
+	}
+	return !bytes.Equal(oldFi.hash, fi.hash)
+}
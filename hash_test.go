@@ -0,0 +1,74 @@
+package dirchanges
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDetectModes(t *testing.T) {
+	testCases := []struct {
+		mode    DetectMode
+		touched bool // expect a Write for a touched but identical file.
+		edited  bool // expect a Write for an edit that kept size and mtime.
+	}{
+		{DetectModTime, true, false},
+		{DetectContent, false, true},
+		{DetectHybrid, false, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mode.String(), func(t *testing.T) {
+			testDir, teardown := setup(t)
+			defer teardown()
+
+			touched := filepath.Join(testDir, "file_1.txt")
+			edited := filepath.Join(testDir, "edited.txt")
+			if err := ioutil.WriteFile(edited, []byte("old"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			// Old enough to not be racy.
+			past := time.Now().Add(-time.Hour)
+			if err := os.Chtimes(edited, past, past); err != nil {
+				t.Fatal(err)
+			}
+
+			w := New()
+			w.SetDetectMode(tc.mode)
+			w.FilterOps(Write)
+			if err := w.Add(testDir); err != nil {
+				t.Fatal(err)
+			}
+
+			future := time.Now().Add(time.Hour)
+			if err := os.Chtimes(touched, future, future); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(edited, []byte("new"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(edited, past, past); err != nil {
+				t.Fatal(err)
+			}
+
+			diff, err := w.Diff()
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := make(map[string]bool)
+			for _, event := range diff {
+				found[event.Path] = true
+			}
+			if found[touched] != tc.touched {
+				t.Errorf("expected Write of touched file to be %t, got %t",
+					tc.touched, found[touched])
+			}
+			if found[edited] != tc.edited {
+				t.Errorf("expected Write of edited file to be %t, got %t",
+					tc.edited, found[edited])
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+// +build !windows
+
+package dirchanges
+
+import "os"
+
+// fileID identifies a file on disk.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// defaultIdentityKey returns the device and inode of info, the same file
+// identity os.SameFile uses.
+func defaultIdentityKey(info os.FileInfo) (interface{}, bool) {
+	fi := toFileInfo(info)
+	if !fi.hasID {
+		return nil, false
+	}
+	return fileID{fi.dev, fi.ino}, true
+}
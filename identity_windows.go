@@ -0,0 +1,25 @@
+// +build windows
+
+package dirchanges
+
+import "os"
+
+// fileID stands in for the identity of a file, which os.FileInfo does not
+// expose on windows.
+type fileID struct {
+	modTime int64
+	size    int64
+	mode    os.FileMode
+	dir     bool
+}
+
+// defaultIdentityKey returns the modification time, size, mode and kind of
+// info, which are likely to be kept when a file is renamed.
+func defaultIdentityKey(info os.FileInfo) (interface{}, bool) {
+	return fileID{
+		modTime: info.ModTime().UnixNano(),
+		size:    info.Size(),
+		mode:    info.Mode(),
+		dir:     info.IsDir(),
+	}, true
+}
@@ -0,0 +1,115 @@
+package dirchanges
+
+import (
+	"os"
+	"sort"
+)
+
+// linkKey identifies a file that can have hard links.
+type linkKey struct {
+	dev uint64
+	ino uint64
+}
+
+// linkKeyOf returns the key of the file described by info. ok is false
+// if it has no identity, or is a directory, which can't be hard linked.
+func linkKeyOf(info os.FileInfo) (key linkKey, ok bool) {
+	fi := toFileInfo(info)
+	if !fi.hasID || fi.dir {
+		return linkKey{}, false
+	}
+	return linkKey{fi.dev, fi.ino}, true
+}
+
+// HardLinks groups the paths in s that are hard links to the same file.
+// Each group has two paths or more, in order, and the groups are ordered
+// by their first path. Files are only grouped where they have an
+// identity, which they don't on windows.
+func (s Snapshot) HardLinks() [][]string {
+	groups := make(map[linkKey][]string)
+	for path, info := range s.Files {
+		if key, ok := linkKeyOf(info); ok {
+			groups[key] = append(groups[key], path)
+		}
+	}
+
+	var res [][]string
+	for _, paths := range groups {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			res = append(res, paths)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i][0] < res[j][0]
+	})
+	return res
+}
+
+// findLinks returns the created files that are new hard links to a file
+// in new, and the removed files that were hard links to a file still in
+// new, as Link and Unlink events, and deletes them from creates and
+// removes. OldPath is set to the first other path of the file in new.
+//
+// Of the created links to a file that is not otherwise in new, the
+// first is left as created.
+func findLinks(old, new Snapshot, creates, removes map[string]os.FileInfo) []Event {
+	// The paths of each file that was already there, or renamed.
+	existing := make(map[linkKey][]string)
+	for path, info := range new.Files {
+		if _, created := creates[path]; created {
+			continue
+		}
+		if key, ok := linkKeyOf(info); ok {
+			existing[key] = append(existing[key], path)
+		}
+	}
+	for _, paths := range existing {
+		sort.Strings(paths)
+	}
+
+	var res []Event
+	for _, path := range sortedPaths(creates) {
+		info := creates[path]
+		key, ok := linkKeyOf(info)
+		if !ok || toFileInfo(info).nlink < 2 {
+			continue
+		}
+		if len(existing[key]) == 0 {
+			existing[key] = []string{path}
+			continue
+		}
+		e := Event{
+			Op:       Link,
+			Path:     path,
+			OldPath:  existing[key][0],
+			FileInfo: info,
+			NewInfo:  info,
+			Links:    toFileInfo(info).nlink,
+		}
+		if oldInfo, found := old.Files[e.OldPath]; found {
+			e.OldLinks = toFileInfo(oldInfo).nlink
+		}
+		res = append(res, e)
+		delete(creates, path)
+	}
+
+	for path, info := range removes {
+		key, ok := linkKeyOf(info)
+		if !ok || toFileInfo(info).nlink < 2 || len(existing[key]) == 0 {
+			continue
+		}
+		linked := existing[key][0]
+		res = append(res, Event{
+			Op:       Unlink,
+			Path:     path,
+			OldPath:  linked,
+			FileInfo: info,
+			OldInfo:  info,
+			OldLinks: toFileInfo(info).nlink,
+			Links:    toFileInfo(new.Files[linked]).nlink,
+		})
+		delete(removes, path)
+	}
+	return res
+}
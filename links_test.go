@@ -0,0 +1,95 @@
+package dirchanges
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCompareLinks(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	file := func(name string, ino, nlink uint64) *fileInfo {
+		return &fileInfo{name: name, mode: 0644, modTime: t1, dev: 1, ino: ino, hasID: true, nlink: nlink}
+	}
+
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/d/a":        file("a", 1, 1),
+		"/d/b":        file("b", 2, 2),
+		"/d/unlinked": file("unlinked", 2, 2),
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/d/a":     file("a", 1, 2),
+		"/d/link":  file("link", 1, 2),
+		"/d/b":     file("b", 2, 1),
+		"/d/new1":  file("new1", 3, 2),
+		"/d/new2":  file("new2", 3, 2),
+		"/d/other": file("other", 4, 1),
+	}}
+
+	expected := []string{
+		"CREATE  -> /d/new1",
+		"CREATE  -> /d/other",
+		"LINK /d/a -> /d/link",
+		"LINK /d/new1 -> /d/new2",
+		"UNLINK /d/b -> /d/unlinked",
+	}
+	events := Compare(old, new)
+	if got := eventStrings(events); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for _, e := range events {
+		if e.Op == Link && e.Path == "/d/link" && (e.OldLinks != 1 || e.Links != 2) {
+			t.Errorf("expected /d/link to raise the links from 1 to 2, got %d to %d", e.OldLinks, e.Links)
+		}
+	}
+
+	groups := [][]string{{"/d/a", "/d/link"}, {"/d/new1", "/d/new2"}}
+	if got := new.HardLinks(); !reflect.DeepEqual(got, groups) {
+		t.Errorf("expected %v, got %v", groups, got)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	// Without file identities, links can't be told apart on windows.
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	w.FilterOps(Create, Remove, Link, Unlink)
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(testDir, "file.txt")
+	link := filepath.Join(testDir, "testDirTwo", "link.txt")
+	if err := os.Link(name, link); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := w.DiffCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"LINK " + name + " -> " + link}
+	if got := eventStrings(diff); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	diff, err = w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"UNLINK " + link + " -> " + name}
+	if got := eventStrings(diff); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,108 @@
+package dirchanges
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mountInfoFile lists the mounts seen by the current process on linux.
+const mountInfoFile = "/proc/self/mountinfo"
+
+// A mount is a mounted file system, as listed in mountInfoFile.
+type mount struct {
+	point   string   // where it's mounted.
+	fsType  string   // type of the file system.
+	options []string // mount and super block options.
+}
+
+// hasOption reports whether m was mounted with option.
+func (m mount) hasOption(option string) bool {
+	for _, o := range m.options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// readMounts returns the mounts listed in mountInfoFile, or none when
+// there is no such file.
+func readMounts() ([]mount, error) {
+	data, err := ioutil.ReadFile(mountInfoFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseMountInfo(data), nil
+}
+
+// parseMountInfo parses the content of a mountinfo file, skipping the
+// lines it can't make sense of. See proc(5).
+func parseMountInfo(data []byte) []mount {
+	var res []mount
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(sc.Text())
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || len(fields) < sep+4 {
+			continue
+		}
+		m := mount{
+			point:   unescapeMountField(fields[4]),
+			fsType:  fields[sep+1],
+			options: strings.Split(fields[5], ","),
+		}
+		m.options = append(m.options, strings.Split(fields[sep+3], ",")...)
+		res = append(res, m)
+	}
+	return res
+}
+
+// unescapeMountField replaces the octal escapes of a mountinfo field,
+// like \040 for a space, by the characters they stand for.
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+4 <= len(field) {
+			if c, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+// mountOf returns the mount the absolute path is on, the last one
+// mounted on the longest mount point that contains path.
+func mountOf(mounts []mount, path string) (mount, bool) {
+	var res mount
+	found := false
+	for _, m := range mounts {
+		if !(osFileSystem{}).Within(m.point, path) {
+			continue
+		}
+		if !found || len(m.point) >= len(res.point) {
+			res, found = m, true
+		}
+	}
+	return res, found
+}
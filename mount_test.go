@@ -0,0 +1,37 @@
+package dirchanges
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	data := []byte(`22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+36 22 98:0 /mnt1 /mnt/with\040space rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+37 22 0:50 / /mnt/usb rw - vfat /dev/sdb1 rw,fmask=0022
+garbage
+`)
+
+	expected := []mount{
+		{"/", "ext4", []string{"rw", "relatime", "rw"}},
+		{"/mnt/with space", "ext3", []string{"rw", "noatime", "rw", "errors=continue"}},
+		{"/mnt/usb", "vfat", []string{"rw", "rw", "fmask=0022"}},
+	}
+	mounts := parseMountInfo(data)
+	if !reflect.DeepEqual(mounts, expected) {
+		t.Fatalf("expected %v, got %v", expected, mounts)
+	}
+
+	testCases := map[string]string{
+		"/":                     "/",
+		"/home/user":            "/",
+		"/mnt/with space/file":  "/mnt/with space",
+		"/mnt/usb":              "/mnt/usb",
+		"/mnt/usbkey/somewhere": "/",
+	}
+	for path, point := range testCases {
+		if m, found := mountOf(mounts, path); !found || m.point != point {
+			t.Errorf("expected %s to be on %s, got %s", path, point, m.point)
+		}
+	}
+}
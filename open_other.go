@@ -0,0 +1,17 @@
+// +build !linux
+
+package dirchanges
+
+import (
+	"io"
+	"os"
+)
+
+// openFile opens the named file for reading.
+func openFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
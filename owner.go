@@ -0,0 +1,44 @@
+package dirchanges
+
+import (
+	"os/user"
+	"strconv"
+)
+
+// An Owner is the user and group that own a file, by id.
+type Owner struct {
+	UID uint32
+	GID uint32
+}
+
+// String prints the ids of o as "uid:gid".
+func (o Owner) String() string {
+	return strconv.FormatUint(uint64(o.UID), 10) + ":" + strconv.FormatUint(uint64(o.GID), 10)
+}
+
+// Names returns the names of the user and the group of o. An id that
+// can't be looked up is returned as is.
+func (o Owner) Names() (userName, groupName string) {
+	userName = strconv.FormatUint(uint64(o.UID), 10)
+	if u, err := user.LookupId(userName); err == nil {
+		userName = u.Username
+	}
+	groupName = strconv.FormatUint(uint64(o.GID), 10)
+	if g, err := user.LookupGroupId(groupName); err == nil {
+		groupName = g.Name
+	}
+	return userName, groupName
+}
+
+// Resolve prints o as "user:group", with the names of the user and the
+// group when they can be looked up.
+func (o Owner) Resolve() string {
+	userName, groupName := o.Names()
+	return userName + ":" + groupName
+}
+
+// chowned reports whether the owner of a file changed from oldFi to fi.
+// Files without a recorded owner are never chowned.
+func chowned(oldFi, fi *fileInfo) bool {
+	return oldFi.hasOwner && fi.hasOwner && oldFi.owner != fi.owner
+}
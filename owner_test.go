@@ -0,0 +1,75 @@
+package dirchanges
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCompareChown(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	file := func(owner Owner, hasOwner bool) *fileInfo {
+		return &fileInfo{name: "f", mode: 0644, modTime: t1, owner: owner, hasOwner: hasOwner}
+	}
+
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/d/chown":   file(Owner{1000, 1000}, true),
+		"/d/kept":    file(Owner{1000, 1000}, true),
+		"/d/unknown": file(Owner{}, false),
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/d/chown":   file(Owner{0, 1000}, true),
+		"/d/kept":    file(Owner{1000, 1000}, true),
+		"/d/unknown": file(Owner{1000, 1000}, true),
+	}}
+
+	events := Compare(old, new)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %v", eventStrings(events))
+	}
+	e := events[0]
+	if e.Op != Chown || e.Path != "/d/chown" || e.Changes != ChangeOwner {
+		t.Errorf("expected a chown of /d/chown, got %s %s [%s]", e.Op, e.Path, e.Changes)
+	}
+	if e.OldOwner.String() != "1000:1000" || e.Owner.String() != "0:1000" {
+		t.Errorf("expected the owner to change from 1000:1000 to 0:1000, got %s -> %s", e.OldOwner, e.Owner)
+	}
+
+	// Ids that can't be looked up are kept as they are.
+	if resolved := (Owner{4000000000, 4000000001}).Resolve(); resolved != "4000000000:4000000001" {
+		t.Errorf("expected 4000000000:4000000001, got %s", resolved)
+	}
+}
+
+func TestChown(t *testing.T) {
+	// Only root can give a file away.
+	if runtime.GOOS == "windows" || os.Getuid() != 0 {
+		return
+	}
+
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(testDir, "file.txt")
+	if err := os.Chown(name, 1234, 5678); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 1 {
+		t.Fatalf("expected 1 event, got %v", eventStrings(diff))
+	}
+	if e := diff[0]; e.Op != Chown || e.Path != name || e.Owner != (Owner{1234, 5678}) {
+		t.Errorf("expected %s to be chowned to 1234:5678, got %s %s %s", name, e.Op, e.Path, e.Owner)
+	}
+}
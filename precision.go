@@ -0,0 +1,126 @@
+package dirchanges
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// fsPrecisions are the resolutions of the modification times of file
+// systems that don't keep them to the nanosecond, by type, as listed in
+// mountInfoFile.
+var fsPrecisions = map[string]time.Duration{
+	"vfat":       2 * time.Second,
+	"msdos":      2 * time.Second,
+	"exfat":      2 * time.Second,
+	"nfs":        time.Second,
+	"nfs4":       time.Second,
+	"cifs":       time.Second,
+	"smb3":       time.Second,
+	"smbfs":      time.Second,
+	"fuse.sshfs": time.Second,
+}
+
+// SetModTimePrecision sets the resolution of modification times. It is
+// the same as setting CompareOptions.ModTimePrecision.
+func (w *Watcher) SetModTimePrecision(precision time.Duration) {
+	w.compare.ModTimePrecision = precision
+	w.scanned = nil
+}
+
+// DetectModTimePrecision sets whether the watcher detects the resolution
+// of the modification times of each name added afterwards, or watched in
+// a baseline set afterwards, from the type of the file system it's on,
+// such as 2 seconds on FAT and 1 second on network file systems. A
+// precision set in CompareOptions.ModTimePrecisions for the same name
+// wins. File systems are only known on linux.
+func (w *Watcher) DetectModTimePrecision(detect bool) {
+	w.detectPrecision = detect
+}
+
+// setPrecision detects and records the resolution of the modification
+// times of the named root, if the watcher detects them.
+func (w *Watcher) setPrecision(name string) error {
+	if !w.detectPrecision {
+		return nil
+	}
+	if _, ok := w.fs.(osFileSystem); !ok {
+		return nil
+	}
+	mounts, err := readMounts()
+	if err != nil {
+		return err
+	}
+	real, err := w.fs.EvalSymlinks(name)
+	if err != nil {
+		return err
+	}
+	if precision, found := mountPrecision(mounts, real); found {
+		if w.precisions == nil {
+			w.precisions = make(map[string]time.Duration)
+		}
+		w.precisions[name] = precision
+	}
+	return nil
+}
+
+// mountPrecision returns the resolution of the modification times of the
+// file system that the real path is on, among mounts, if it is known.
+func mountPrecision(mounts []mount, real string) (time.Duration, bool) {
+	m, found := mountOf(mounts, real)
+	if !found {
+		return 0, false
+	}
+	precision, found := fsPrecisions[m.fsType]
+	return precision, found
+}
+
+// compareOptions returns the options the watcher compares files with,
+// including the detected precisions.
+func (w *Watcher) compareOptions() CompareOptions {
+	opts := w.compare
+	if len(w.precisions) == 0 {
+		return opts
+	}
+	opts.ModTimePrecisions = make(map[string]time.Duration)
+	for dir, precision := range w.precisions {
+		opts.ModTimePrecisions[dir] = precision
+	}
+	for dir, precision := range w.compare.ModTimePrecisions {
+		opts.ModTimePrecisions[dir] = precision
+	}
+	return opts
+}
+
+// precisionOf returns the resolution of the modification time of the
+// file at path.
+func (o CompareOptions) precisionOf(path string) time.Duration {
+	precision, longest := o.ModTimePrecision, -1
+	for dir, p := range o.ModTimePrecisions {
+		if len(dir) > longest && inDir(dir, path) {
+			precision, longest = p, len(dir)
+		}
+	}
+	return precision
+}
+
+// inDir reports whether path is dir or is inside of it, with either
+// kind of separator.
+func inDir(dir, path string) bool {
+	if !strings.HasPrefix(path, dir) {
+		return false
+	}
+	rest := path[len(dir):]
+	return rest == "" || rest[0] == '/' || rest[0] == os.PathSeparator ||
+		strings.HasSuffix(dir, "/") || strings.HasSuffix(dir, string(os.PathSeparator))
+}
+
+// sameModTime reports whether the modification times t1 and t2 are less
+// than precision apart, or equal when precision is 0.
+func sameModTime(t1, t2 time.Time, precision time.Duration) bool {
+	if precision <= 0 {
+		return t1.Equal(t2)
+	}
+	d := t1.Sub(t2)
+	return -precision < d && d < precision
+}
@@ -0,0 +1,150 @@
+package dirchanges
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPrecisionOf(t *testing.T) {
+	opts := CompareOptions{
+		ModTimePrecision: time.Millisecond,
+		ModTimePrecisions: map[string]time.Duration{
+			"/mnt":     time.Second,
+			"/mnt/usb": 2 * time.Second,
+		},
+	}
+	testCases := map[string]time.Duration{
+		"/home/file":     time.Millisecond,
+		"/mnt":           time.Second,
+		"/mnt/file":      time.Second,
+		"/mnt/usb/file":  2 * time.Second,
+		"/mnt/usbkey/f":  time.Second,
+		"/mntpoint/file": time.Millisecond,
+	}
+	for path, expected := range testCases {
+		if precision := opts.precisionOf(path); precision != expected {
+			t.Errorf("expected %s to have a precision of %s, got %s", path, expected, precision)
+		}
+	}
+}
+
+func TestComparePrecision(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 10, 500000000, time.UTC)
+	file := func(name string, modTime time.Time) *fileInfo {
+		return &fileInfo{name: name, mode: 0644, modTime: modTime}
+	}
+
+	// Copied to FAT, with times rounded up to 2 seconds, and truncated to
+	// the second by a round trip through some archive format.
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/fat/a":     file("a", t1),
+		"/fat/b":     file("b", t1),
+		"/archive/c": file("c", t1),
+		"/archive/d": file("d", t1),
+		"/precise/e": file("e", t1),
+		"/precise/f": file("f", t1),
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/fat/a":     file("a", t1.Add(1500*time.Millisecond)),
+		"/fat/b":     file("b", t1.Add(3*time.Second)),
+		"/archive/c": file("c", t1.Truncate(time.Second)),
+		"/archive/d": file("d", t1.Add(time.Second)),
+		"/precise/e": file("e", t1.Truncate(time.Second)),
+		"/precise/f": file("f", t1),
+	}}
+
+	opts := CompareOptions{
+		ModTimePrecision:  time.Second,
+		ModTimePrecisions: map[string]time.Duration{"/fat": 2 * time.Second, "/precise": 0},
+	}
+	expected := []string{
+		"WRITE /archive/d -> /archive/d",
+		"WRITE /fat/b -> /fat/b",
+		"WRITE /precise/e -> /precise/e",
+	}
+	if got := eventStrings(CompareWith(old, new, opts)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestDetectModTimePrecision(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	w.DetectModTimePrecision(true)
+	if err := w.Add(testDir); err != nil {
+		t.Fatal(err)
+	}
+	// Whatever the test directory is on, an explicit precision wins.
+	w.SetCompareOptions(CompareOptions{ModTimePrecisions: map[string]time.Duration{testDir: time.Minute}})
+	if precision := w.compareOptions().precisionOf(testDir); precision != time.Minute {
+		t.Errorf("expected a precision of 1m, got %s", precision)
+	}
+}
+
+func TestMountPrecision(t *testing.T) {
+	mounts := parseMountInfo([]byte(`22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+37 22 0:50 / /mnt/usb rw - vfat /dev/sdb1 rw,fmask=0022
+38 22 0:51 / /mnt/nas rw - nfs4 nas:/export rw
+`))
+
+	testCases := map[string]time.Duration{
+		"/home/user":        0,
+		"/mnt/usb":          2 * time.Second,
+		"/mnt/usb/DCIM/a.j": 2 * time.Second,
+		"/mnt/nas/backup":   time.Second,
+		"/mnt/usbkey":       0,
+	}
+	for path, expected := range testCases {
+		precision, found := mountPrecision(mounts, path)
+		if found != (expected != 0) || precision != expected {
+			t.Errorf("expected %s to have a precision of %s, got %t %s", path, expected, found, precision)
+		}
+	}
+}
+
+func TestPrecisionOfRoots(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	w.DetectModTimePrecision(true)
+	if err := w.Add(testDir); err != nil {
+		t.Fatal(err)
+	}
+	detected, found := w.precisions[testDir]
+	s := w.Snapshot()
+
+	// Pretend the test directory is on FAT, if it isn't.
+	w.precisions = map[string]time.Duration{testDir: 2 * time.Second}
+	if err := w.Remove(testDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := w.precisions[testDir]; found {
+		t.Errorf("expected the precision of %s to be removed with it", testDir)
+	}
+
+	// Whatever the test directory is on, the precision of the roots of a
+	// baseline is detected like when they are added.
+	if err := w.SetBaseline(s); err != nil {
+		t.Fatal(err)
+	}
+	if precision, ok := w.precisions[testDir]; ok != found || precision != detected {
+		t.Errorf("expected the precision of %s to be detected again as %t %s, got %t %s",
+			testDir, found, detected, ok, precision)
+	}
+
+	// A root that is gone is left to Diff.
+	if err := os.RemoveAll(testDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetBaseline(s); err != nil {
+		t.Errorf("expected a gone root to be ignored, got %v", err)
+	}
+	if _, err := w.Diff(); err != ErrWatchedFileDeleted {
+		t.Errorf("expected %v, got %v", ErrWatchedFileDeleted, err)
+	}
+}
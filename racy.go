@@ -0,0 +1,55 @@
+package dirchanges
+
+import (
+	"os"
+	"time"
+)
+
+// racyWindow is the least time before a listing in which a file that was
+// modified is racy, for file systems with a fine resolution: their clock
+// may lag behind time.Now.
+const racyWindow = time.Second
+
+// markRacy marks the regular files in files that were modified too close
+// to taken, when they were listed, to be told apart from a later write
+// by their modification time, like git's racily clean entries. They are
+// hashed if they aren't already, so that the next Diff can verify them
+// by content. Files that are gone since they were listed are dropped
+// from files, and files that can't be read are left unhashed, and not
+// racy.
+func (w *Watcher) markRacy(files map[string]os.FileInfo, taken time.Time) error {
+	opts := w.compareOptions()
+
+	todo := make(map[string]*fileInfo)
+	for path, info := range files {
+		fi := toFileInfo(info)
+		if !fi.mode.IsRegular() {
+			continue
+		}
+		window := opts.precisionOf(path)
+		if window < racyWindow {
+			window = racyWindow
+		}
+		if fi.modTime.Before(taken.Add(-window)) {
+			continue
+		}
+		files[path] = fi
+		fi.racy = true
+		if fi.hash == nil {
+			todo[path] = fi
+		}
+	}
+	gone, err := w.hashAll(todo, false, true)
+	if err != nil {
+		return err
+	}
+	for _, path := range gone {
+		delete(files, path)
+	}
+	for _, fi := range todo {
+		if fi.hash == nil {
+			fi.racy = false
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package dirchanges
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMarkRacy(t *testing.T) {
+	taken := time.Date(2020, 1, 1, 0, 0, 10, 0, time.UTC)
+	files := map[string]os.FileInfo{
+		"/d/old":      &fileInfo{name: "old", mode: 0644, modTime: taken.Add(-time.Minute), hash: []byte{1}},
+		"/d/recent":   &fileInfo{name: "recent", mode: 0644, modTime: taken.Add(-time.Second / 2), hash: []byte{1}},
+		"/d/future":   &fileInfo{name: "future", mode: 0644, modTime: taken.Add(time.Hour), hash: []byte{1}},
+		"/d/dir":      &fileInfo{name: "dir", mode: os.ModeDir | 0755, modTime: taken, dir: true},
+		"/fat/recent": &fileInfo{name: "recent", mode: 0644, modTime: taken.Add(-3 * time.Second / 2), hash: []byte{1}},
+	}
+
+	w := New()
+	w.SetCompareOptions(CompareOptions{ModTimePrecisions: map[string]time.Duration{"/fat": 2 * time.Second}})
+	if err := w.markRacy(files, taken); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]bool{
+		"/d/old":      false,
+		"/d/recent":   true,
+		"/d/future":   true,
+		"/d/dir":      false,
+		"/fat/recent": true,
+	}
+	for path, racy := range expected {
+		if toFileInfo(files[path]).racy != racy {
+			t.Errorf("expected %s to be racy: %t", path, racy)
+		}
+	}
+}
+
+func TestRacy(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	racy := filepath.Join(testDir, "racy.txt")
+	clean := filepath.Join(testDir, "clean.txt")
+	past := time.Now().Add(-time.Hour)
+	for _, name := range []string{racy, clean} {
+		if err := ioutil.WriteFile(name, []byte("old"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(clean, past, past); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(racy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := New()
+	w.FilterOps(Write)
+	if err := w.Add(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// The racy entry survives a round trip through the snapshot format.
+	var buf bytes.Buffer
+	if err := w.Snapshot().Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetBaseline(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edit both files within the same modification time.
+	for _, name := range []string{racy, clean} {
+		if err := ioutil.WriteFile(name, []byte("new"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(clean, past, past); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(racy, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the racy file is verified by content; the directory was not
+	// changed since the files were created.
+	if len(diff) != 1 || diff[0].Path != racy {
+		t.Errorf("expected a write of %s only, got %v", racy, eventStrings(diff))
+	}
+}
+
+func TestRacyVanished(t *testing.T) {
+	for _, mode := range []DetectMode{DetectModTime, DetectContent} {
+		testDir, teardown := setup(t)
+
+		name := filepath.Join(testDir, "vanished.txt")
+		if err := ioutil.WriteFile(name, []byte("gone"), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		// Remove the file as soon as it's listed, before it can be hashed.
+		w := New()
+		w.SetDetectMode(mode)
+		w.AddFilterHook(func(info os.FileInfo, fullPath string) error {
+			if fullPath == name {
+				return os.Remove(name)
+			}
+			return nil
+		})
+		if err := w.Add(testDir); err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if _, found := w.files[name]; found {
+			t.Errorf("%s: expected %s to be dropped", mode, name)
+		}
+
+		// The file was never in the baseline, so it isn't reported removed.
+		w.FilterOps(Remove)
+		diff, err := w.Diff()
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if got := eventStrings(diff); len(got) != 0 {
+			t.Errorf("%s: expected no events, got %v", mode, got)
+		}
+		teardown()
+	}
+}
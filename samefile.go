@@ -1,9 +0,0 @@
-// +build !windows
-
-package dirchanges
-
-import "os"
-
-func sameFile(fi1, fi2 os.FileInfo) bool {
-	return os.SameFile(fi1, fi2)
-}
@@ -0,0 +1,240 @@
+package dirchanges
+
+import (
+	"bytes"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// maxSignedSize is the size of the largest file whose signature is
+// recorded. Larger files are only paired when they are identical.
+const maxSignedSize = 64 << 20
+
+// maxSpanSize is the size of the longest span of a signature.
+const maxSpanSize = 64
+
+// A signature summarizes the content of a file, as the number of bytes
+// in each of its spans, by hash of the span, sorted by hash. Spans end
+// at a newline or after maxSpanSize bytes, so that similar files share
+// most of their spans, like in git's rename detection.
+type signature []spanCount
+
+type spanCount struct {
+	hash  uint32
+	count uint32
+}
+
+// signer computes the signature of what's written to it.
+type signer struct {
+	span   []byte
+	counts map[uint32]uint32
+}
+
+func newSigner() *signer {
+	return &signer{
+		span:   make([]byte, 0, maxSpanSize),
+		counts: make(map[uint32]uint32),
+	}
+}
+
+func (s *signer) Write(p []byte) (int, error) {
+	for _, b := range p {
+		s.span = append(s.span, b)
+		if b == '\n' || len(s.span) == maxSpanSize {
+			s.flush()
+		}
+	}
+	return len(p), nil
+}
+
+func (s *signer) flush() {
+	if len(s.span) == 0 {
+		return
+	}
+	h := fnv.New32a()
+	h.Write(s.span)
+	s.counts[h.Sum32()] += uint32(len(s.span))
+	s.span = s.span[:0]
+}
+
+// signature returns the signature of everything written so far.
+func (s *signer) signature() signature {
+	s.flush()
+	sig := make(signature, 0, len(s.counts))
+	for hash, count := range s.counts {
+		sig = append(sig, spanCount{hash, count})
+	}
+	sort.Slice(sig, func(i, j int) bool { return sig[i].hash < sig[j].hash })
+	return sig
+}
+
+// similarity returns how similar the content of two files is, in percent,
+// as the number of bytes they have in common, compared to the larger one.
+// Empty files are not similar to anything.
+func similarity(fi1, fi2 *fileInfo) int {
+	if fi1.size > 0 && fi1.hash != nil && bytes.Equal(fi1.hash, fi2.hash) {
+		return 100
+	}
+	max := fi1.size
+	if fi2.size > max {
+		max = fi2.size
+	}
+	if max == 0 || fi1.sig == nil || fi2.sig == nil {
+		return 0
+	}
+
+	var common int64
+	sig1, sig2 := fi1.sig, fi2.sig
+	for len(sig1) > 0 && len(sig2) > 0 {
+		switch {
+		case sig1[0].hash < sig2[0].hash:
+			sig1 = sig1[1:]
+		case sig1[0].hash > sig2[0].hash:
+			sig2 = sig2[1:]
+		default:
+			count := sig1[0].count
+			if sig2[0].count < count {
+				count = sig2[0].count
+			}
+			common += int64(count)
+			sig1, sig2 = sig1[1:], sig2[1:]
+		}
+	}
+	return int(common * 100 / max)
+}
+
+// DefaultRenameLimit is the rename limit used when
+// CompareOptions.RenameLimit is 0: only identical files are paired by
+// RenameSimilarity when the number of removed times created files is
+// above its square.
+const DefaultRenameLimit = 1000
+
+// pairBySimilarity pairs the regular files in removes and creates whose
+// content is at least threshold percent similar, best matches first, and
+// returns them as moves and renames. Paired files are deleted from both.
+//
+// Identical files are paired first, by hash. The others are only scored
+// when the number of removed times created regular files left is no
+// more than limit squared, as scoring compares each removed file to
+// each created one, like git's diff.renameLimit.
+func pairBySimilarity(removes, creates map[string]os.FileInfo, threshold, limit int) []Event {
+	res := pairIdentical(removes, creates)
+
+	if limit == 0 {
+		limit = DefaultRenameLimit
+	}
+	n, m := regularFiles(removes), regularFiles(creates)
+	if limit > 0 && n*m > limit*limit {
+		return res
+	}
+
+	type candidate struct {
+		oldPath, path string
+		score         int
+	}
+	var candidates []candidate
+	for oldPath, oldInfo := range removes {
+		oldFi := toFileInfo(oldInfo)
+		if !oldFi.mode.IsRegular() {
+			continue
+		}
+		for path, info := range creates {
+			fi := toFileInfo(info)
+			if !fi.mode.IsRegular() {
+				continue
+			}
+			// Skip files whose sizes are too far apart to be similar.
+			min, max := oldFi.size, fi.size
+			if min > max {
+				min, max = max, min
+			}
+			if min*100 < max*int64(threshold) {
+				continue
+			}
+			if score := similarity(oldFi, fi); score >= threshold {
+				candidates = append(candidates, candidate{oldPath, path, score})
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		if ci.score != cj.score {
+			return ci.score > cj.score
+		}
+		if ci.oldPath != cj.oldPath {
+			return ci.oldPath < cj.oldPath
+		}
+		return ci.path < cj.path
+	})
+
+	for _, c := range candidates {
+		if _, found := removes[c.oldPath]; !found {
+			continue
+		}
+		if _, found := creates[c.path]; !found {
+			continue
+		}
+		res = append(res, similarMove(removes, creates, c.oldPath, c.path, c.score))
+	}
+	return res
+}
+
+// pairIdentical pairs the non empty regular files in removes and creates
+// that have the same hash, in order, like pairBySimilarity.
+func pairIdentical(removes, creates map[string]os.FileInfo) []Event {
+	index := make(map[string][]string)
+	for _, path := range sortedPaths(creates) {
+		fi := toFileInfo(creates[path])
+		if fi.mode.IsRegular() && fi.size > 0 && fi.hash != nil {
+			index[string(fi.hash)] = append(index[string(fi.hash)], path)
+		}
+	}
+
+	var res []Event
+	for _, oldPath := range sortedPaths(removes) {
+		oldFi := toFileInfo(removes[oldPath])
+		if !oldFi.mode.IsRegular() || oldFi.size == 0 || oldFi.hash == nil {
+			continue
+		}
+		paths := index[string(oldFi.hash)]
+		if len(paths) == 0 {
+			continue
+		}
+		index[string(oldFi.hash)] = paths[1:]
+		res = append(res, similarMove(removes, creates, oldPath, paths[0], 100))
+	}
+	return res
+}
+
+// similarMove returns the move or rename of the file at oldPath in
+// removes to path in creates, with score, and deletes both.
+func similarMove(removes, creates map[string]os.FileInfo, oldPath, path string, score int) Event {
+	e := Event{
+		Op:       Move,
+		Path:     path,
+		OldPath:  oldPath,
+		FileInfo: removes[oldPath],
+		OldInfo:  removes[oldPath],
+		NewInfo:  creates[path],
+		Score:    score,
+	}
+	if filepath.Dir(oldPath) == filepath.Dir(path) {
+		e.Op = Rename
+	}
+	delete(removes, oldPath)
+	delete(creates, path)
+	return e
+}
+
+// regularFiles returns the number of regular files in files.
+func regularFiles(files map[string]os.FileInfo) int {
+	n := 0
+	for _, info := range files {
+		if info.Mode().IsRegular() {
+			n++
+		}
+	}
+	return n
+}
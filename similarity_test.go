@@ -0,0 +1,157 @@
+package dirchanges
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lines returns n numbered lines of text.
+func lines(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "this is line number %d\n", i)
+	}
+	return b.String()
+}
+
+func TestSimilarity(t *testing.T) {
+	sign := func(content string) *fileInfo {
+		s := newSigner()
+		s.Write([]byte(content))
+		return &fileInfo{size: int64(len(content)), sig: s.signature()}
+	}
+
+	testCases := []struct {
+		a, b     string
+		min, max int
+	}{
+		{lines(10), lines(10), 100, 100},
+		{lines(10), lines(10) + lines(10), 50, 50},
+		{lines(10), strings.Replace(lines(10), "number 3", "number X", 1), 85, 95},
+		{lines(10), strings.ToUpper(lines(10)), 0, 0},
+		{"", "", 0, 0},
+	}
+	for _, tc := range testCases {
+		score := similarity(sign(tc.a), sign(tc.b))
+		if score < tc.min || score > tc.max {
+			t.Errorf("expected a score between %d and %d, got %d", tc.min, tc.max, score)
+		}
+	}
+}
+
+func TestRenameSimilarity(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	content := lines(20)
+	files := map[string]string{
+		"exact.txt":   content,
+		"edited.txt":  content + "a",
+		"changed.txt": content + "b",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(testDir, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := New()
+	w.SetCompareOptions(CompareOptions{RenameSimilarity: 80})
+	w.FilterOps(Create, Remove, Rename, Move)
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Round trip the baseline, to make sure it keeps what's needed.
+	var buf bytes.Buffer
+	if err := w.Snapshot().Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetBaseline(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite the files under new names, so they don't keep their inodes.
+	rewrites := map[string]string{
+		"exact.txt":   content,
+		"edited.txt":  strings.Replace(content, "number 3", "number X", 1) + "a",
+		"changed.txt": strings.ToUpper(content),
+	}
+	for name, content := range rewrites {
+		err := ioutil.WriteFile(filepath.Join(testDir, "testDirTwo", name), []byte(content), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name := range rewrites {
+		if err := os.Remove(filepath.Join(testDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diff, err := w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	moves := make(map[string]int)
+	for _, event := range diff {
+		if event.Op == Move {
+			moves[event.Name()] = event.Score
+		}
+	}
+	if score, found := moves["exact.txt"]; !found || score != 100 {
+		t.Errorf("expected exact.txt to move with a score of 100, got %t %d", found, score)
+	}
+	if score, found := moves["edited.txt"]; !found || score < 80 || score == 100 {
+		t.Errorf("expected edited.txt to move with a score between 80 and 100, got %t %d", found, score)
+	}
+	if _, found := moves["changed.txt"]; found {
+		t.Errorf("expected changed.txt to not move")
+	}
+	if len(diff) != 4 {
+		t.Errorf("expected 2 moves, a create and a remove, got %v", diff)
+	}
+}
+
+func TestRenameLimit(t *testing.T) {
+	file := func(content string) *fileInfo {
+		s := newSigner()
+		s.Write([]byte(content))
+		sum := sha256.Sum256([]byte(content))
+		return &fileInfo{size: int64(len(content)), sig: s.signature(), hash: sum[:]}
+	}
+	content := lines(20)
+	edited := strings.Replace(content, "number 3", "number X", 1)
+
+	testCases := []struct {
+		limit    int
+		expected []string
+	}{
+		{0, []string{"RENAME /d/a.txt -> /d/c.txt", "RENAME /d/b.txt -> /d/d.txt"}},
+		{-1, []string{"RENAME /d/a.txt -> /d/c.txt", "RENAME /d/b.txt -> /d/d.txt"}},
+		{1, []string{"RENAME /d/a.txt -> /d/c.txt"}},
+	}
+	for _, tc := range testCases {
+		removes := map[string]os.FileInfo{"/d/a.txt": file(content), "/d/b.txt": file(content + "b")}
+		creates := map[string]os.FileInfo{
+			"/d/c.txt": file(content),
+			"/d/d.txt": file(edited + "b"),
+			"/d/e.txt": file(strings.ToUpper(content)),
+		}
+		got := eventStrings(pairBySimilarity(removes, creates, 80, tc.limit))
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("with a limit of %d, expected %v, got %v", tc.limit, tc.expected, got)
+		}
+	}
+}
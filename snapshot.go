@@ -0,0 +1,258 @@
+package dirchanges
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SnapshotVersion is the version of the snapshot format written by Save.
+const SnapshotVersion = 1
+
+// ErrSnapshotVersion is returned when reading a snapshot written in a
+// format version this package does not understand.
+var ErrSnapshotVersion = errors.New("error: unsupported snapshot version")
+
+// A Snapshot is a point-in-time record of the watched files. It can be
+// saved to disk and loaded later, so that a baseline recorded in one
+// process can be diffed against in another.
+type Snapshot struct {
+	Taken time.Time              // when the files were listed.
+	Roots map[string]bool        // watched names, bool for recursive or not.
+	Files map[string]os.FileInfo // map of files.
+}
+
+// snapshotFile is the on-disk representation of a Snapshot.
+type snapshotFile struct {
+	Version int             `json:"version"`
+	Taken   time.Time       `json:"taken"`
+	Roots   map[string]bool `json:"roots"`
+	Files   []snapshotEntry `json:"files"`
+}
+
+type snapshotEntry struct {
+	Path    string        `json:"path"`
+	Size    int64         `json:"size"`
+	Mode    os.FileMode   `json:"mode"`
+	ModTime time.Time     `json:"mtime"`
+	CTime   *time.Time    `json:"ctime,omitempty"`
+	ATime   *time.Time    `json:"atime,omitempty"`
+	Dir     bool          `json:"dir,omitempty"`
+	ID      *snapshotID   `json:"id,omitempty"`
+	Owner   *Owner        `json:"owner,omitempty"`
+	Hash    []byte        `json:"sha256,omitempty"`
+	Sig     [][2]uint32   `json:"sig,omitempty"` // span hashes and counts.
+	Target  string        `json:"target,omitempty"`
+	Rdev    *DeviceNumber `json:"rdev,omitempty"`
+	Racy    bool          `json:"racy,omitempty"`
+
+	// Xattrs is nil when they were not recorded, and empty when the
+	// file has none.
+	Xattrs *map[string]xattrValue `json:"xattrs,omitempty"`
+}
+
+// snapshotID is the file identity used to detect renames and moves.
+type snapshotID struct {
+	Dev   uint64 `json:"dev"`
+	Ino   uint64 `json:"ino"`
+	Nlink uint64 `json:"nlink,omitempty"`
+}
+
+// Save writes s to wr in the versioned snapshot format.
+func (s Snapshot) Save(wr io.Writer) error {
+	out := snapshotFile{
+		Version: SnapshotVersion,
+		Taken:   s.Taken,
+		Roots:   s.Roots,
+		Files:   make([]snapshotEntry, 0, len(s.Files)),
+	}
+	for path, info := range s.Files {
+		fi := toFileInfo(info)
+		e := snapshotEntry{
+			Path:    path,
+			Size:    fi.size,
+			Mode:    fi.mode,
+			ModTime: fi.modTime,
+			Dir:     fi.dir,
+			Hash:    fi.hash,
+			Target:  fi.target,
+			Racy:    fi.racy,
+		}
+		for _, span := range fi.sig {
+			e.Sig = append(e.Sig, [2]uint32{span.hash, span.count})
+		}
+		if fi.hasID {
+			e.ID = &snapshotID{Dev: fi.dev, Ino: fi.ino, Nlink: fi.nlink}
+		}
+		if isDevice(fi) {
+			rdev := fi.rdev
+			e.Rdev = &rdev
+		}
+		if !fi.changeTime.IsZero() {
+			changeTime := fi.changeTime
+			e.CTime = &changeTime
+		}
+		if !fi.accessTime.IsZero() {
+			accessTime := fi.accessTime
+			e.ATime = &accessTime
+		}
+		if fi.hasOwner {
+			owner := fi.owner
+			e.Owner = &owner
+		}
+		if fi.xattrs != nil {
+			xattrs := fi.xattrs
+			e.Xattrs = &xattrs
+		}
+		out.Files = append(out.Files, e)
+	}
+	// Keep the output stable so snapshots can be compared textually.
+	sort.Slice(out.Files, func(i, j int) bool {
+		return out.Files[i].Path < out.Files[j].Path
+	})
+
+	enc := json.NewEncoder(wr)
+	enc.SetIndent("", "\t")
+	return enc.Encode(out)
+}
+
+// SaveFile writes s to the named file, replacing it atomically.
+func (s Snapshot) SaveFile(name string) (err error) {
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if err = s.Save(f); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// ReadSnapshot reads a snapshot written by Save from r.
+func ReadSnapshot(r io.Reader) (Snapshot, error) {
+	var in snapshotFile
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return Snapshot{}, err
+	}
+	if in.Version != SnapshotVersion {
+		return Snapshot{}, fmt.Errorf("%w: %d", ErrSnapshotVersion, in.Version)
+	}
+
+	s := Snapshot{
+		Taken: in.Taken,
+		Roots: in.Roots,
+		Files: make(map[string]os.FileInfo, len(in.Files)),
+	}
+	if s.Roots == nil {
+		s.Roots = make(map[string]bool)
+	}
+	for _, e := range in.Files {
+		fi := &fileInfo{
+			name:    filepath.Base(e.Path),
+			size:    e.Size,
+			mode:    e.Mode,
+			modTime: e.ModTime,
+			dir:     e.Dir,
+			hash:    e.Hash,
+			target:  e.Target,
+			racy:    e.Racy,
+		}
+		if e.Sig != nil {
+			fi.sig = make(signature, 0, len(e.Sig))
+			for _, span := range e.Sig {
+				fi.sig = append(fi.sig, spanCount{hash: span[0], count: span[1]})
+			}
+		}
+		if e.ID != nil {
+			fi.dev, fi.ino, fi.hasID = e.ID.Dev, e.ID.Ino, true
+			fi.nlink = e.ID.Nlink
+		}
+		if e.Rdev != nil {
+			fi.rdev = *e.Rdev
+		}
+		if e.CTime != nil {
+			fi.changeTime = *e.CTime
+		}
+		if e.ATime != nil {
+			fi.accessTime = *e.ATime
+		}
+		if e.Owner != nil {
+			fi.owner, fi.hasOwner = *e.Owner, true
+		}
+		if e.Xattrs != nil {
+			fi.xattrs = *e.Xattrs
+		}
+		s.Files[e.Path] = fi
+	}
+	return s, nil
+}
+
+// LoadSnapshot reads a snapshot from the named file.
+func LoadSnapshot(name string) (Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer f.Close()
+
+	return ReadSnapshot(f)
+}
+
+// Snapshot returns a copy of the Watcher's current baseline.
+func (w *Watcher) Snapshot() Snapshot {
+	s := Snapshot{
+		Taken: w.taken,
+		Roots: make(map[string]bool, len(w.names)),
+		Files: w.WatchedFiles(),
+	}
+	for k, v := range w.names {
+		s.Roots[k] = v
+	}
+	return s
+}
+
+// SetBaseline replaces the Watcher's baseline and watched names with the
+// ones recorded in s, so that Diff reports changes made since s was taken.
+//
+// Filter hooks, ignored paths and Op filters of the Watcher are kept.
+// The resolution of the modification times of the roots is detected
+// again; if that fails, the baseline is set regardless and the error is
+// returned.
+func (w *Watcher) SetBaseline(s Snapshot) error {
+	w.scanned = nil
+	w.taken = s.Taken
+	w.names = make(map[string]bool, len(s.Roots))
+	for k, v := range s.Roots {
+		w.names[k] = v
+	}
+	w.files = make(map[string]os.FileInfo, len(s.Files))
+	for k, v := range s.Files {
+		w.files[k] = v
+	}
+
+	w.precisions = nil
+	for name := range s.Roots {
+		// A root that is gone has no precision, and makes Diff return
+		// ErrWatchedFileDeleted.
+		if err := w.setPrecision(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package dirchanges
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := w.Snapshot().Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files) != 8 {
+		t.Errorf("expected 8 files, found %d", len(s.Files))
+	}
+	if recursive, found := s.Roots[testDir]; !found || !recursive {
+		t.Errorf("expected s.Roots to contain testDir as recursive")
+	}
+
+	for path, info := range w.files {
+		loaded, found := s.Files[path]
+		if !found {
+			t.Errorf("expected to find %s", path)
+			continue
+		}
+		if loaded.Name() != info.Name() {
+			t.Errorf("expected name %s, got %s", info.Name(), loaded.Name())
+		}
+		if loaded.Size() != info.Size() || loaded.Mode() != info.Mode() ||
+			loaded.IsDir() != info.IsDir() || !loaded.ModTime().Equal(info.ModTime()) {
+			t.Errorf("expected %s to round trip unchanged", path)
+		}
+		loadedKey, _ := defaultIdentityKey(loaded)
+		if key, _ := defaultIdentityKey(info); key != loadedKey {
+			t.Errorf("expected %s to keep its identity", path)
+		}
+	}
+}
+
+func TestDiffAgainstLoadedSnapshot(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshotDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(snapshotDir)
+
+	name := filepath.Join(snapshotDir, "baseline.json")
+	if err := w.Snapshot().SaveFile(name); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadSnapshot(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newFile := filepath.Join(testDir, "newfile.txt")
+	if err := ioutil.WriteFile(newFile, []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh Watcher diffs against the loaded baseline.
+	w = New()
+	if err := w.SetBaseline(s); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the new file and the mtime of its directory changed.
+	if len(diff) != 2 {
+		t.Fatalf("expected 2 events, got %d: %v", len(diff), diff)
+	}
+	for _, event := range diff {
+		switch {
+		case event.Op == Create && event.Path == newFile:
+		case event.Op == Write && event.Path == testDir:
+		default:
+			t.Errorf("unexpected event %s", event)
+		}
+	}
+}
+
+func TestReadSnapshotVersion(t *testing.T) {
+	_, err := ReadSnapshot(strings.NewReader(`{"version": 999}`))
+	if !errors.Is(err, ErrSnapshotVersion) {
+		t.Errorf("expected ErrSnapshotVersion, got %v", err)
+	}
+}
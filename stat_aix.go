@@ -0,0 +1,12 @@
+// +build aix
+
+package dirchanges
+
+// deviceNumber splits rdev into its major and minor numbers, from the
+// 64-bit dev_t of AIX, whose top 2 bits are flags.
+func deviceNumber(rdev uint64) DeviceNumber {
+	return DeviceNumber{
+		Major: uint32((rdev & 0x3fffffff00000000) >> 32),
+		Minor: uint32(rdev & 0xffffffff),
+	}
+}
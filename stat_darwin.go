@@ -0,0 +1,13 @@
+// +build darwin
+
+package dirchanges
+
+// deviceNumber splits rdev into its major and minor numbers, the way
+// darwin's major and minor macros do: 8 bits of major number above 24
+// bits of minor number.
+func deviceNumber(rdev uint64) DeviceNumber {
+	return DeviceNumber{
+		Major: uint32(rdev>>24) & 0xff,
+		Minor: uint32(rdev) & 0xffffff,
+	}
+}
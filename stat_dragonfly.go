@@ -0,0 +1,13 @@
+// +build dragonfly
+
+package dirchanges
+
+// deviceNumber splits rdev into its major and minor numbers. DragonFly
+// keeps the major number in the second byte, and the minor number in the
+// bits around it.
+func deviceNumber(rdev uint64) DeviceNumber {
+	return DeviceNumber{
+		Major: uint32(rdev>>8) & 0xff,
+		Minor: uint32(rdev) & 0xffff00ff,
+	}
+}
@@ -0,0 +1,12 @@
+// +build freebsd
+
+package dirchanges
+
+// deviceNumber splits rdev into its major and minor numbers, as encoded
+// in the 64-bit dev_t of FreeBSD 12 and later.
+func deviceNumber(rdev uint64) DeviceNumber {
+	return DeviceNumber{
+		Major: uint32((rdev>>32)&0xffffff00 | (rdev>>8)&0xff),
+		Minor: uint32((rdev>>24)&0xff00 | rdev&0xffff00ff),
+	}
+}
@@ -0,0 +1,23 @@
+// +build linux
+
+package dirchanges
+
+import (
+	"syscall"
+	"time"
+)
+
+// fillTimes copies the times of st that os.FileInfo lacks into fi.
+func fillTimes(fi *fileInfo, st *syscall.Stat_t) {
+	fi.changeTime = time.Unix(st.Ctim.Unix())
+	fi.accessTime = time.Unix(st.Atim.Unix())
+}
+
+// deviceNumber splits rdev into its major and minor numbers, the way
+// glibc's gnu_dev_major and gnu_dev_minor do.
+func deviceNumber(rdev uint64) DeviceNumber {
+	return DeviceNumber{
+		Major: uint32((rdev>>8)&0xfff | (rdev>>32)&^0xfff),
+		Minor: uint32(rdev&0xff | (rdev>>12)&^0xff),
+	}
+}
@@ -0,0 +1,80 @@
+// +build linux
+
+package dirchanges
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSuspectCtime(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	name := filepath.Join(testDir, "file.txt")
+	// Old enough to not be racy.
+	past := time.Now().Add(-time.Hour)
+
+	for _, mode := range []DetectMode{DetectModTime, DetectHybrid} {
+		t.Run(mode.String(), func(t *testing.T) {
+			if err := ioutil.WriteFile(name, []byte("before"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(name, past, past); err != nil {
+				t.Fatal(err)
+			}
+
+			w := New()
+			w.SetCompareOptions(CompareOptions{Detect: mode, SuspectCtime: true})
+			if err := w.Add(name); err != nil {
+				t.Fatal(err)
+			}
+
+			// Write the same size, and reset the modification time.
+			if err := ioutil.WriteFile(name, []byte("forged"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(name, past, past); err != nil {
+				t.Fatal(err)
+			}
+
+			diff, err := w.Diff()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(diff) != 1 {
+				t.Fatalf("expected 1 event, got %v", eventStrings(diff))
+			}
+			// Content comparison confirms the write.
+			suspicious := mode == DetectModTime
+			if e := diff[0]; e.Op != Write || e.Suspicious != suspicious {
+				t.Errorf("expected a write, suspicious: %t, got %s %t", suspicious, e.Op, e.Suspicious)
+			}
+
+			// Without the option, the write is missed.
+			w.SetCompareOptions(CompareOptions{Detect: mode})
+			diff, err = w.Diff()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(diff) != 0 {
+				t.Errorf("expected no events, got %v", eventStrings(diff))
+			}
+		})
+	}
+}
+
+func TestDeviceNumber(t *testing.T) {
+	testCases := map[uint64]DeviceNumber{
+		0x103:      {1, 3},
+		0x11110370: {259, 70000},
+	}
+	for rdev, expected := range testCases {
+		if d := deviceNumber(rdev); d != expected {
+			t.Errorf("expected %#x to be %s, got %s", rdev, expected, d)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+// +build netbsd
+
+package dirchanges
+
+// deviceNumber splits rdev into its major and minor numbers, like
+// NetBSD's major and minor macros, which keep 12 bits of major number
+// between the low and high bits of the minor number.
+func deviceNumber(rdev uint64) DeviceNumber {
+	return DeviceNumber{
+		Major: uint32((rdev & 0x000fff00) >> 8),
+		Minor: uint32(rdev&0x000000ff | (rdev&0xfff00000)>>12),
+	}
+}
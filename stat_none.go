@@ -0,0 +1,8 @@
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package dirchanges
+
+// fillSys copies the platform specific parts of sys into fi.
+//
+// Only unix and windows are known, so there is nothing to copy.
+func fillSys(fi *fileInfo, sys interface{}) {}
@@ -0,0 +1,12 @@
+// +build openbsd
+
+package dirchanges
+
+// deviceNumber splits rdev into its major and minor numbers, like
+// OpenBSD's major and minor macros.
+func deviceNumber(rdev uint64) DeviceNumber {
+	return DeviceNumber{
+		Major: uint32((rdev & 0x0000ff00) >> 8),
+		Minor: uint32(rdev&0x000000ff | (rdev&0xffff0000)>>8),
+	}
+}
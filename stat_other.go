@@ -0,0 +1,10 @@
+// +build aix darwin dragonfly freebsd netbsd openbsd solaris
+
+package dirchanges
+
+import "syscall"
+
+// fillTimes copies the times of st that os.FileInfo lacks into fi.
+//
+// They are only recorded on linux, so there is nothing to copy.
+func fillTimes(fi *fileInfo, st *syscall.Stat_t) {}
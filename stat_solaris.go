@@ -0,0 +1,12 @@
+// +build solaris
+
+package dirchanges
+
+// deviceNumber splits rdev into its major and minor numbers, as 64-bit
+// processes see them on Solaris and illumos, with 32 bits each.
+func deviceNumber(rdev uint64) DeviceNumber {
+	return DeviceNumber{
+		Major: uint32(rdev >> 32),
+		Minor: uint32(rdev & 0xffffffff),
+	}
+}
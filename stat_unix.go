@@ -0,0 +1,23 @@
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package dirchanges
+
+import "syscall"
+
+// fillSys copies the platform specific parts of sys into fi.
+func fillSys(fi *fileInfo, sys interface{}) {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	fi.dev = uint64(st.Dev)
+	fi.ino = uint64(st.Ino)
+	fi.hasID = true
+	fi.nlink = uint64(st.Nlink)
+	fi.owner = Owner{UID: st.Uid, GID: st.Gid}
+	fi.hasOwner = true
+	if isDevice(fi) {
+		fi.rdev = deviceNumber(uint64(st.Rdev))
+	}
+	fillTimes(fi, st)
+}
@@ -0,0 +1,9 @@
+// +build windows
+
+package dirchanges
+
+// fillSys copies the platform specific parts of sys into fi.
+//
+// Windows does not expose a file identity or owner through os.FileInfo,
+// so there is nothing to copy.
+func fillSys(fi *fileInfo, sys interface{}) {}
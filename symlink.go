@@ -0,0 +1,162 @@
+package dirchanges
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// A SymlinkPolicy describes whether a Watcher follows symbolic links
+// found in watched directories.
+//
+// A watched name that is itself a symbolic link is always followed,
+// by Add and AddRecursive alike.
+type SymlinkPolicy uint32
+
+// Symlink policies
+const (
+	// SymlinkNoFollow records symbolic links themselves. It is the default.
+	SymlinkNoFollow SymlinkPolicy = iota
+	// SymlinkFollow records what symbolic links point to, and lists
+	// linked directories recursively.
+	SymlinkFollow
+	// SymlinkFollowWithinRoots follows only the symbolic links that point
+	// inside one of the watched names, and records the others themselves.
+	SymlinkFollowWithinRoots
+)
+
+var symlinkPolicies = map[SymlinkPolicy]string{
+	SymlinkNoFollow:          "NOFOLLOW",
+	SymlinkFollow:            "FOLLOW",
+	SymlinkFollowWithinRoots: "FOLLOWWITHINROOTS",
+}
+
+// String prints the string version of the SymlinkPolicy consts
+func (p SymlinkPolicy) String() string {
+	if policy, found := symlinkPolicies[p]; found {
+		return policy
+	}
+	return "???"
+}
+
+// SetSymlinkPolicy sets whether the watcher follows symbolic links.
+//
+// Followed links to directories are not listed again when they point to
+// one of their own parents, so link cycles can't make listing loop. Links
+// to directories are only followed on file systems that identify files.
+func (w *Watcher) SetSymlinkPolicy(policy SymlinkPolicy) {
+	w.symlinks = policy
+	w.scanned = nil
+}
+
+// dirChain is a directory being listed, with the directories above it.
+type dirChain struct {
+	parent *dirChain
+	dev    uint64
+	ino    uint64
+}
+
+// push returns the chain with fi appended. Directories without identity
+// are left out, as they can't be told apart anyway.
+func (c *dirChain) push(fi *fileInfo) *dirChain {
+	if !fi.hasID {
+		return c
+	}
+	return &dirChain{parent: c, dev: fi.dev, ino: fi.ino}
+}
+
+// contains reports whether fi is one of the directories of the chain.
+func (c *dirChain) contains(fi *fileInfo) bool {
+	for ; c != nil; c = c.parent {
+		if c.dev == fi.dev && c.ino == fi.ino {
+			return true
+		}
+	}
+	return false
+}
+
+// setRealRoots resolves the watched names, plus the given ones, for
+// SymlinkFollowWithinRoots. Names that can't be resolved are skipped.
+func (w *Watcher) setRealRoots(names ...string) {
+	w.realRoots = nil
+	if w.symlinks != SymlinkFollowWithinRoots {
+		return
+	}
+	for root := range w.names {
+		names = append(names, root)
+	}
+	for _, name := range names {
+		if real, err := w.fs.EvalSymlinks(name); err == nil {
+			w.realRoots = append(w.realRoots, real)
+		}
+	}
+}
+
+// followLink returns the info to record for path, whose Lstat info is
+// info, in a directory listed under chain. Unless path is a symbolic link
+// that should be followed, info itself is returned. Links that can't be
+// followed, because they're dangling or would loop, are also recorded
+// themselves.
+func (w *Watcher) followLink(path string, info os.FileInfo, chain *dirChain) os.FileInfo {
+	if info.Mode()&os.ModeSymlink == 0 || w.symlinks == SymlinkNoFollow {
+		return info
+	}
+
+	if w.symlinks == SymlinkFollowWithinRoots {
+		real, err := w.fs.EvalSymlinks(path)
+		if err != nil {
+			return info
+		}
+		within := false
+		for _, root := range w.realRoots {
+			if w.fs.Within(root, real) {
+				within = true
+				break
+			}
+		}
+		if !within {
+			return info
+		}
+	}
+
+	stat, err := w.fs.Stat(path)
+	if err != nil {
+		return info
+	}
+	if stat.IsDir() {
+		fi := newFileInfo(stat)
+		if !fi.hasID || chain.contains(fi) {
+			return info
+		}
+	}
+	return stat
+}
+
+// statName returns the info of the watched name, following it if it's a
+// symbolic link. A dangling link is returned itself.
+func (w *Watcher) statName(name string) (os.FileInfo, error) {
+	info, err := w.fs.Stat(name)
+	if os.IsNotExist(err) {
+		if linfo, lerr := w.fs.Lstat(name); lerr == nil && linfo.Mode()&os.ModeSymlink != 0 {
+			return linfo, nil
+		}
+	}
+	return info, err
+}
+
+// readLink records the target of fi, if it's a symbolic link at path.
+func (w *Watcher) readLink(path string, fi *fileInfo) error {
+	if fi.mode&os.ModeSymlink == 0 {
+		return nil
+	}
+	target, err := w.fs.Readlink(path)
+	if errors.Is(err, fs.ErrInvalid) {
+		// The file system can't read links.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fi.target = target
+	return nil
+}
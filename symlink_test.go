@@ -0,0 +1,185 @@
+package dirchanges
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestSymlinkPolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	outside, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := ioutil.WriteFile(filepath.Join(outside, "out.txt"), []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	links := map[string]string{
+		"outside": outside,
+		"inside":  "testDirTwo",
+		"loop":    ".",
+		"file":    "file.txt",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(testDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		policy   SymlinkPolicy
+		followed []string // links recorded as what they point to.
+		listed   []string // files found through followed links.
+	}{
+		{SymlinkNoFollow, nil, nil},
+		{SymlinkFollow, []string{"outside", "inside", "file"},
+			[]string{"outside/out.txt", "inside/file_recursive.txt"}},
+		{SymlinkFollowWithinRoots, []string{"inside", "file"},
+			[]string{"inside/file_recursive.txt"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			w := New()
+			w.SetSymlinkPolicy(tc.policy)
+			if err := w.AddRecursive(testDir); err != nil {
+				t.Fatal(err)
+			}
+
+			// The 8 files of setup and the 4 links.
+			if expected := 12 + len(tc.listed); len(w.files) != expected {
+				t.Errorf("expected %d files, found %d", expected, len(w.files))
+			}
+
+			followed := make(map[string]bool)
+			for _, name := range tc.followed {
+				followed[name] = true
+			}
+			for name := range links {
+				info, found := w.files[filepath.Join(testDir, name)]
+				if !found {
+					t.Errorf("expected to find %s", name)
+					continue
+				}
+				if isLink := info.Mode()&os.ModeSymlink != 0; isLink == followed[name] {
+					t.Errorf("expected %s to be followed: %t", name, followed[name])
+				}
+			}
+			for _, name := range tc.listed {
+				if _, found := w.files[filepath.Join(testDir, name)]; !found {
+					t.Errorf("expected to find %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestRetarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	link := filepath.Join(testDir, "link")
+	dangling := filepath.Join(testDir, "dangling")
+	if err := os.Symlink("file_1.txt", link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("nowhere", dangling); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New()
+	if err := w.Add(testDir); err != nil {
+		t.Fatal(err)
+	}
+	// A dangling link can be watched like any other file.
+	if err := w.Add(dangling); err != nil {
+		t.Fatal(err)
+	}
+	if target := toFileInfo(w.files[dangling]).target; target != "nowhere" {
+		t.Errorf("expected dangling to point to nowhere, got %q", target)
+	}
+
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file_2.txt", link); err != nil {
+		t.Fatal(err)
+	}
+
+	w.FilterOps(Retarget)
+	diff, err := w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 1 {
+		t.Fatalf("expected 1 event, got %v", diff)
+	}
+	if e := diff[0]; e.Path != link || e.OldTarget != "file_1.txt" || e.Target != "file_2.txt" {
+		t.Errorf("expected %s to be retargeted from file_1.txt to file_2.txt, got %s %q -> %q",
+			link, e.Path, e.OldTarget, e.Target)
+	}
+}
+
+func TestRetargetByRename(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	link := filepath.Join(testDir, "link")
+	if err := os.Symlink("file_1.txt", link); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New()
+	w.FilterOps(Replace, Retarget, Write)
+	if err := w.Add(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Repoint the link atomically, by renaming a new one over it.
+	temp := filepath.Join(testDir, "link~")
+	if err := os.Symlink("file_2.txt", temp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(temp, link); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, e := range diff {
+		if e.Path != link {
+			continue
+		}
+		ops = append(ops, e.Op.String())
+		if e.OldTarget != "file_1.txt" || e.Target != "file_2.txt" {
+			t.Errorf("expected %s to be retargeted from file_1.txt to file_2.txt, got %s %q -> %q",
+				link, e.Op, e.OldTarget, e.Target)
+		}
+	}
+	if expected := []string{"REPLACE", "RETARGET"}; !reflect.DeepEqual(ops, expected) {
+		t.Errorf("expected %v, got %v", expected, ops)
+	}
+}
@@ -0,0 +1,194 @@
+package dirchanges
+
+import (
+	"os"
+	"sync"
+)
+
+// SetWorkers sets the number of goroutines that list and hash the files of
+// recursively watched names concurrently. With n <= 1, the default, files
+// are listed one by one.
+//
+// With more than one worker, filter hooks are called concurrently and must
+// be safe for concurrent use. The listed files are the same either way.
+func (w *Watcher) SetWorkers(n int) {
+	w.workers = n
+}
+
+// walkEntry is a file found while listing a watched name recursively.
+type walkEntry struct {
+	path   string
+	rel    string // path relative to the watched name, slash separated.
+	info   os.FileInfo
+	ignore *gitignore // patterns that apply to the entries of path.
+	chain  *dirChain  // directories above path.
+}
+
+// walkEntry adds e to the file list with add, unless it's filtered out.
+// If e is a directory that's not skipped, each of its entries is passed
+// to push, the same way filepath.Walk would visit them.
+func (w *Watcher) walkEntry(e walkEntry, add func(string, os.FileInfo), push func(walkEntry) error) error {
+	fi := newFileInfo(e.info)
+	skip := false
+	for _, f := range w.ffh {
+		err := f(e.info, e.path)
+		if err == ErrSkip {
+			skip = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !skip {
+		// If path is ignored and it's a directory, skip the directory. If it's
+		// ignored and it's a single file, skip the file.
+		_, ignored := w.ignored[e.path]
+
+		isHidden, err := w.fs.IsHidden(e.path)
+		if err != nil {
+			return err
+		}
+
+		if ignored || (w.ignoreHidden && isHidden) ||
+			(e.rel != "" && e.ignore.ignored(e.rel, e.info.IsDir())) {
+			return nil
+		}
+		// Add the path and it's info to the file list.
+		if err := w.readLink(e.path, fi); err != nil {
+			return err
+		}
+		add(e.path, fi)
+	}
+
+	if !e.info.IsDir() {
+		return nil
+	}
+	infos, err := w.fs.ReadDir(e.path)
+	if err != nil {
+		return err
+	}
+	ignore := e.ignore
+	if e.rel != "" {
+		if ignore, err = w.dirGitignore(ignore, e.path, e.rel); err != nil {
+			return err
+		}
+	}
+	chain := e.chain.push(fi)
+	for _, info := range infos {
+		path := w.fs.Join(e.path, info.Name())
+		rel := info.Name()
+		if e.rel != "" {
+			rel = e.rel + "/" + rel
+		}
+		err := push(walkEntry{
+			path:   path,
+			rel:    rel,
+			info:   w.followLink(path, info, chain),
+			ignore: ignore,
+			chain:  chain,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkParallel lists root recursively with w.workers goroutines, each
+// reading one directory at a time.
+func (w *Watcher) walkParallel(root walkEntry) (map[string]os.FileInfo, error) {
+	q := &walkQueue{entries: []walkEntry{root}, pending: 1}
+	q.cond = sync.NewCond(&q.mu)
+
+	lists := make([]map[string]os.FileInfo, w.workers)
+	var wg sync.WaitGroup
+	for i := range lists {
+		fileList := make(map[string]os.FileInfo)
+		lists[i] = fileList
+
+		add := func(path string, info os.FileInfo) {
+			fileList[path] = info
+		}
+		push := func(e walkEntry) error {
+			// Directories are left to any worker, other files are
+			// handled right away.
+			if e.info.IsDir() {
+				q.push(e)
+				return nil
+			}
+			return w.walkEntry(e, add, nil)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				e, ok := q.pop()
+				if !ok {
+					return
+				}
+				q.done(w.walkEntry(e, add, push))
+			}
+		}()
+	}
+	wg.Wait()
+
+	fileList := lists[0]
+	for _, list := range lists[1:] {
+		for k, v := range list {
+			fileList[k] = v
+		}
+	}
+	return fileList, q.err
+}
+
+// walkQueue holds the directories waiting to be read by walkParallel.
+type walkQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	entries []walkEntry
+	pending int   // entries queued or being read.
+	err     error // first error encountered.
+}
+
+func (q *walkQueue) push(e walkEntry) {
+	q.mu.Lock()
+	q.entries = append(q.entries, e)
+	q.pending++
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop returns the next entry to read, or false when all entries were
+// read or an error occurred.
+func (q *walkQueue) pop() (walkEntry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.entries) == 0 && q.pending > 0 && q.err == nil {
+		q.cond.Wait()
+	}
+	if q.err != nil || len(q.entries) == 0 {
+		return walkEntry{}, false
+	}
+	// Take the last entry, so the walk goes depth first and the queue
+	// stays short.
+	e := q.entries[len(q.entries)-1]
+	q.entries = q.entries[:len(q.entries)-1]
+	return e, true
+}
+
+// done marks an entry returned by pop as read.
+func (q *walkQueue) done(err error) {
+	q.mu.Lock()
+	q.pending--
+	if err != nil && q.err == nil {
+		q.err = err
+	}
+	if q.pending == 0 || q.err != nil {
+		q.cond.Broadcast()
+	}
+	q.mu.Unlock()
+}
@@ -0,0 +1,65 @@
+package dirchanges
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestSetWorkers(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	// Add a few more levels of directories to list.
+	for i := 0; i < 5; i++ {
+		dir := filepath.Join(testDir, fmt.Sprintf("dir_%d", i), "sub", ".hidden")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"a.txt", "b.log", ".c.txt"} {
+			for _, d := range []string{dir, filepath.Dir(dir)} {
+				err := ioutil.WriteFile(filepath.Join(d, name), []byte(name), 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	list := func(workers int) map[string]os.FileInfo {
+		w := New()
+		w.SetWorkers(workers)
+		w.SetDetectMode(DetectContent)
+		w.IgnoreHiddenFiles(true)
+		w.AddFilterHook(RegexFilterHook(regexp.MustCompile(`\.log$`), false))
+		if err := w.Ignore(filepath.Join(testDir, "dir_3")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.AddRecursive(testDir); err != nil {
+			t.Fatal(err)
+		}
+		return w.files
+	}
+
+	expected := list(1)
+	if len(expected) == 0 {
+		t.Fatal("expected to find .log files")
+	}
+	got := list(8)
+	if len(got) != len(expected) {
+		t.Errorf("expected %d files, found %d", len(expected), len(got))
+	}
+	for path, info := range expected {
+		gotInfo, found := got[path]
+		if !found {
+			t.Errorf("expected to find %s", path)
+			continue
+		}
+		if string(toFileInfo(gotInfo).hash) != string(toFileInfo(info).hash) {
+			t.Errorf("expected %s to have the same hash", path)
+		}
+	}
+}
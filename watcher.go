@@ -3,9 +3,8 @@ package dirchanges
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -30,15 +29,37 @@ const (
 	Rename
 	Chmod
 	Move
+	Retarget
+	TypeChange
+	Copy
+	Replace
+	Chown
+	Xattr
+	Access
+	Link
+	Unlink
+	DeviceChange
+	Attrib
 )
 
 var ops = map[Op]string{
-	Create: "CREATE",
-	Write:  "WRITE",
-	Remove: "REMOVE",
-	Rename: "RENAME",
-	Chmod:  "CHMOD",
-	Move:   "MOVE",
+	Create:       "CREATE",
+	Write:        "WRITE",
+	Remove:       "REMOVE",
+	Rename:       "RENAME",
+	Chmod:        "CHMOD",
+	Move:         "MOVE",
+	Retarget:     "RETARGET",
+	TypeChange:   "TYPECHANGE",
+	Copy:         "COPY",
+	Replace:      "REPLACE",
+	Chown:        "CHOWN",
+	Xattr:        "XATTR",
+	Access:       "ACCESS",
+	Link:         "LINK",
+	Unlink:       "UNLINK",
+	DeviceChange: "DEVICECHANGE",
+	Attrib:       "ATTRIB",
 }
 
 // String prints the string version of the Op consts
@@ -57,6 +78,54 @@ type Event struct {
 	Path    string
 	OldPath string
 	os.FileInfo
+
+	// OldInfo and NewInfo describe the file before and after the event.
+	// OldInfo is nil for a Create or a Link, and NewInfo for a Remove or
+	// an Unlink. For a Copy, OldInfo describes the copied file.
+	OldInfo os.FileInfo
+	NewInfo os.FileInfo
+
+	// OldTarget and Target are what a symbolic link pointed to before
+	// and after a Retarget, and on the other events of the same link.
+	OldTarget string
+	Target    string
+
+	// OldType and Type are the types of the file before and after the
+	// event. OldType is only set when the file existed before, and Type
+	// is the type of the file before a Remove or an Unlink.
+	OldType FileType
+	Type    FileType
+
+	// OldDevice and Device are what a device file stood for before and
+	// after the event, as for Type. They change with a DeviceChange.
+	OldDevice DeviceNumber
+	Device    DeviceNumber
+
+	// OldOwner and Owner are who owned the file before and after a
+	// Chown, or any other change of a file whose owner was recorded.
+	OldOwner Owner
+	Owner    Owner
+
+	// OldLinks and Links are the number of hard links of the file before
+	// and after the event, when they are known. For a Link or an Unlink,
+	// OldPath is another path of the same file.
+	OldLinks uint64
+	Links    uint64
+
+	// Xattrs lists the extended attributes changed by an Xattr.
+	Xattrs XattrChanges
+
+	// Suspicious is set on a Write found by CompareOptions.SuspectCtime,
+	// whose content should be verified.
+	Suspicious bool
+
+	// Changes is what changed about a file that is in both snapshots,
+	// or that moved along with its directory. See CompareOptions.Coalesce.
+	Changes Change
+
+	// Score is how similar, in percent, the content of a file is before
+	// and after a Move or Rename found by CompareOptions.RenameSimilarity.
+	Score int
 }
 
 // String returns a string depending on what type of event occurred and the
@@ -69,10 +138,35 @@ func (e Event) String() string {
 	pathType := "FILE"
 	if e.IsDir() {
 		pathType = "DIRECTORY"
+	} else if t := fileTypeOf(e.Mode()); t != TypeRegular && t != TypeSymlink {
+		// Tell special files apart.
+		pathType = t.String()
 	}
 	return fmt.Sprintf("%s %q %s [%s]", pathType, e.Name(), e.Op, e.Path)
 }
 
+// SizeDelta returns how many bytes the file grew by in the event. A file
+// that didn't exist before or after the event counts as empty.
+func (e Event) SizeDelta() int64 {
+	var delta int64
+	if e.NewInfo != nil {
+		delta += e.NewInfo.Size()
+	}
+	if e.OldInfo != nil {
+		delta -= e.OldInfo.Size()
+	}
+	return delta
+}
+
+// ModeChanges returns the mode bits that differ before and after the
+// event, or 0 if the file didn't exist before or after it.
+func (e Event) ModeChanges() os.FileMode {
+	if e.OldInfo == nil || e.NewInfo == nil {
+		return 0
+	}
+	return e.OldInfo.Mode() ^ e.NewInfo.Mode()
+}
+
 // FilterFileHookFunc is a function that is called to filter files during listings.
 // If a file is ok to be listed, nil is returned otherwise ErrSkip is returned.
 type FilterFileHookFunc func(info os.FileInfo, fullPath string) error
@@ -105,31 +199,72 @@ type Watcher struct {
 	files        map[string]os.FileInfo // map of files.
 	ignored      map[string]struct{}    // ignored files or directories.
 	ops          map[Op]struct{}        // Op filtering.
+	types        map[FileType]struct{}  // FileType filtering.
 	ignoreHidden bool                   // ignore hidden files or not.
+	fs           fileSystem             // where files are listed from.
+
+	workers        int                // number of goroutines listing files.
+	symlinks       SymlinkPolicy      // whether symbolic links are followed.
+	realRoots      []string           // resolved watched names, for symlinks.
+	patterns       []gitignorePattern // ignored patterns.
+	gitignoreFiles bool               // ignore files matched by .gitignore files or not.
+	taken          time.Time          // when files was last listed.
+	compare        CompareOptions     // how files are compared.
+	xattrs         *XattrOptions      // extended attributes recorded, if any.
+
+	detectPrecision bool                     // detect the precision of modification times or not.
+	precisions      map[string]time.Duration // detected precisions, by watched name.
+
+	// scanned is the snapshot taken by the last Diff, to be made the
+	// new baseline by Commit. Anything that changes how files are listed
+	// or recorded clears it.
+	scanned *Snapshot
 }
 
-// New creates a new Watcher.
+// New creates a new Watcher, watching the file system of the operating
+// system.
 func New() *Watcher {
+	return newWatcher(osFileSystem{})
+}
+
+// NewFS creates a new Watcher, watching fsys instead of the file system of
+// the operating system. Names passed to the Watcher and paths in its events
+// are slash separated paths relative to the root of fsys, as described by
+// fs.ValidPath.
+//
+// Renames and moves are only detected if the os.FileInfo returned by fsys
+// identifies files, like the ones of os.DirFS do. Otherwise they are
+// reported as a Remove and a Create.
+func NewFS(fsys fs.FS) *Watcher {
+	return newWatcher(ioFileSystem{fsys})
+}
+
+func newWatcher(fsys fileSystem) *Watcher {
 	return &Watcher{
 		files:   make(map[string]os.FileInfo),
 		ignored: make(map[string]struct{}),
 		names:   make(map[string]bool),
+		fs:      fsys,
 	}
 }
 
 // AddFilterHook
 func (w *Watcher) AddFilterHook(f FilterFileHookFunc) {
 	w.ffh = append(w.ffh, f)
+	w.scanned = nil
 }
 
 // IgnoreHiddenFiles sets the watcher to ignore any file or directory
 // that starts with a dot.
 func (w *Watcher) IgnoreHiddenFiles(ignore bool) {
 	w.ignoreHidden = ignore
+	w.scanned = nil
 }
 
 // FilterOps filters which event op types should be returned
-// when an event occurs.
+// when an event occurs. With CompareOptions.Coalesce, an event is also
+// returned when it has the changes of one of ops, so FilterOps(Chmod)
+// keeps a Write whose mode changed too.
 func (w *Watcher) FilterOps(ops ...Op) {
 	w.ops = make(map[Op]struct{})
 	for _, op := range ops {
@@ -141,12 +276,16 @@ func (w *Watcher) list(name string) (map[string]os.FileInfo, error) {
 	fileList := make(map[string]os.FileInfo)
 
 	// Make sure name exists.
-	stat, err := os.Stat(name)
+	stat, err := w.statName(name)
 	if err != nil {
 		return nil, err
 	}
 
-	fileList[name] = stat
+	rootInfo := newFileInfo(stat)
+	if err := w.readLink(name, rootInfo); err != nil {
+		return nil, err
+	}
+	fileList[name] = rootInfo
 
 	// If it's not a directory, just return.
 	if !stat.IsDir() {
@@ -154,24 +293,31 @@ func (w *Watcher) list(name string) (map[string]os.FileInfo, error) {
 	}
 
 	// It's a directory.
-	fInfoList, err := ioutil.ReadDir(name)
+	fInfoList, err := w.fs.ReadDir(name)
 	if err != nil {
 		return nil, err
 	}
+	ignore, err := w.rootGitignore(name)
+	if err != nil {
+		return nil, err
+	}
+	chain := (*dirChain)(nil).push(rootInfo)
 	// Add all of the files in the directory to the file list as long
 	// as they aren't on the ignored list or are hidden files if ignoreHidden
 	// is set to true.
 outer:
 	for _, fInfo := range fInfoList {
-		path := filepath.Join(name, fInfo.Name())
+		path := w.fs.Join(name, fInfo.Name())
+		fInfo = w.followLink(path, fInfo, chain)
 		_, ignored := w.ignored[path]
 
-		isHidden, err := isHiddenFile(path)
+		isHidden, err := w.fs.IsHidden(path)
 		if err != nil {
 			return nil, err
 		}
 
-		if ignored || (w.ignoreHidden && isHidden) {
+		if ignored || (w.ignoreHidden && isHidden) ||
+			ignore.ignored(fInfo.Name(), fInfo.IsDir()) {
 			continue
 		}
 
@@ -185,27 +331,47 @@ outer:
 			}
 		}
 
-		fileList[path] = fInfo
+		fi := newFileInfo(fInfo)
+		if err := w.readLink(path, fi); err != nil {
+			return nil, err
+		}
+		fileList[path] = fi
 	}
 	return fileList, nil
 }
 
 func (w *Watcher) AddRecursive(name string) (err error) {
-	name, err = filepath.Abs(name)
+	name, err = w.fs.Abs(name)
 	if err != nil {
 		return err
 	}
 
+	taken := time.Now()
+	w.setRealRoots(name)
+	if err := w.setPrecision(name); err != nil {
+		return err
+	}
 	fileList, err := w.listRecursive(name)
 	if err != nil {
 		return err
 	}
+	if err := w.hashFiles(fileList, nil); err != nil {
+		return err
+	}
+	if err := w.markRacy(fileList, taken); err != nil {
+		return err
+	}
+	if err := w.readXattrs(fileList); err != nil {
+		return err
+	}
+	w.taken = taken
 	for k, v := range fileList {
 		w.files[k] = v
 	}
 
 	// Add the name to the names list.
 	w.names[name] = true
+	w.scanned = nil
 
 	return nil
 }
@@ -213,52 +379,42 @@ func (w *Watcher) AddRecursive(name string) (err error) {
 func (w *Watcher) listRecursive(name string) (map[string]os.FileInfo, error) {
 	fileList := make(map[string]os.FileInfo)
 
-	return fileList, filepath.Walk(name, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		for _, f := range w.ffh {
-			err := f(info, path)
-			if err == ErrSkip {
-				return nil
-			}
-			if err != nil {
-				return err
-			}
-		}
-
-		// If path is ignored and it's a directory, skip the directory. If it's
-		// ignored and it's a single file, skip the file.
-		_, ignored := w.ignored[path]
-
-		isHidden, err := isHiddenFile(path)
-		if err != nil {
-			return err
-		}
+	// Like Add, follow name if it's a symbolic link.
+	info, err := w.statName(name)
+	if err != nil {
+		return fileList, err
+	}
+	ignore, err := w.rootGitignore(name)
+	if err != nil {
+		return fileList, err
+	}
+	root := walkEntry{path: name, info: info, ignore: ignore}
 
-		if ignored || (w.ignoreHidden && isHidden) {
-			if info.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		// Add the path and it's info to the file list.
+	if w.workers > 1 {
+		return w.walkParallel(root)
+	}
+	add := func(path string, info os.FileInfo) {
 		fileList[path] = info
-		return nil
-	})
+	}
+	var push func(e walkEntry) error
+	push = func(e walkEntry) error {
+		return w.walkEntry(e, add, push)
+	}
+	return fileList, push(root)
 }
 
 // Remove removes either a single file or directory from the file's list.
 func (w *Watcher) Remove(name string) (err error) {
 
-	name, err = filepath.Abs(name)
+	name, err = w.fs.Abs(name)
 	if err != nil {
 		return err
 	}
 
 	// Remove the name from w's names list.
 	delete(w.names, name)
+	delete(w.precisions, name)
+	w.scanned = nil
 
 	// If name is a single file, remove it and return.
 	info, found := w.files[name]
@@ -275,7 +431,7 @@ func (w *Watcher) Remove(name string) (err error) {
 
 	// If it's a directory, delete all of it's contents from w.files.
 	for path := range w.files {
-		if filepath.Dir(path) == name {
+		if w.fs.Dir(path) == name {
 			delete(w.files, path)
 		}
 	}
@@ -286,13 +442,15 @@ func (w *Watcher) Remove(name string) (err error) {
 // the file's list.
 func (w *Watcher) RemoveRecursive(name string) (err error) {
 
-	name, err = filepath.Abs(name)
+	name, err = w.fs.Abs(name)
 	if err != nil {
 		return err
 	}
 
 	// Remove the name from w's names list.
 	delete(w.names, name)
+	delete(w.precisions, name)
+	w.scanned = nil
 
 	// If name is a single file, remove it and return.
 	info, found := w.files[name]
@@ -319,7 +477,7 @@ func (w *Watcher) RemoveRecursive(name string) (err error) {
 // For files that are already added, Ignore removes them.
 func (w *Watcher) Ignore(paths ...string) (err error) {
 	for _, path := range paths {
-		path, err = filepath.Abs(path)
+		path, err = w.fs.Abs(path)
 		if err != nil {
 			return err
 		}
@@ -353,6 +511,57 @@ type fileInfo struct {
 	modTime time.Time
 	sys     interface{}
 	dir     bool
+
+	// dev and ino identify the file on disk, when hasID is set.
+	dev   uint64
+	ino   uint64
+	hasID bool
+	nlink uint64 // number of hard links.
+
+	rdev DeviceNumber // what a device file stands for.
+
+	// owner owns the file, when hasOwner is set.
+	owner    Owner
+	hasOwner bool
+
+	// changeTime is the inode change time, and accessTime the last
+	// access time, zero if not recorded.
+	changeTime time.Time
+	accessTime time.Time
+
+	// xattrs are the recorded extended attributes, nil if not recorded.
+	xattrs map[string]xattrValue
+
+	// racy is set when the file was modified too close to when it was
+	// listed, and should be verified by content. See markRacy.
+	racy bool
+
+	hash   []byte    // content hash, if the file was hashed.
+	sig    signature // content signature, for similarity.
+	target string    // target of a symbolic link.
+}
+
+// newFileInfo copies info, together with the platform specific
+// parts of info.Sys() that are needed to compare files later.
+func newFileInfo(info os.FileInfo) *fileInfo {
+	fi := &fileInfo{
+		name:    info.Name(),
+		size:    info.Size(),
+		mode:    info.Mode(),
+		modTime: info.ModTime(),
+		sys:     info.Sys(),
+		dir:     info.IsDir(),
+	}
+	fillSys(fi, fi.sys)
+	return fi
+}
+
+// toFileInfo returns info as a *fileInfo, copying it if needed.
+func toFileInfo(info os.FileInfo) *fileInfo {
+	if fi, ok := info.(*fileInfo); ok {
+		return fi
+	}
+	return newFileInfo(info)
 }
 
 func (fs *fileInfo) IsDir() bool {
@@ -377,7 +586,7 @@ func (fs *fileInfo) Sys() interface{} {
 // Add adds either a single file or directory to the file list.
 func (w *Watcher) Add(name string) (err error) {
 
-	name, err = filepath.Abs(name)
+	name, err = w.fs.Abs(name)
 	if err != nil {
 		return err
 	}
@@ -386,7 +595,7 @@ func (w *Watcher) Add(name string) (err error) {
 	// ignored and name is a hidden file or directory, simply return.
 	_, ignored := w.ignored[name]
 
-	isHidden, err := isHiddenFile(name)
+	isHidden, err := w.fs.IsHidden(name)
 	if err != nil {
 		return err
 	}
@@ -396,20 +605,42 @@ func (w *Watcher) Add(name string) (err error) {
 	}
 
 	// Add the directory's contents to the files list.
+	taken := time.Now()
+	w.setRealRoots(name)
+	if err := w.setPrecision(name); err != nil {
+		return err
+	}
 	fileList, err := w.list(name)
 	if err != nil {
 		return err
 	}
+	if err := w.hashFiles(fileList, nil); err != nil {
+		return err
+	}
+	if err := w.markRacy(fileList, taken); err != nil {
+		return err
+	}
+	if err := w.readXattrs(fileList); err != nil {
+		return err
+	}
+	w.taken = taken
 	for k, v := range fileList {
 		w.files[k] = v
 	}
 
 	// Add the name to the names list.
 	w.names[name] = false
+	w.scanned = nil
 
 	return nil
 }
 
+// isPathError reports whether err is an *os.PathError about name.
+func isPathError(err error, name string) bool {
+	var pathErr *os.PathError
+	return errors.As(err, &pathErr) && pathErr.Path == name
+}
+
 func (w *Watcher) retrieveFileList() (map[string]os.FileInfo, error) {
 
 	fileList := make(map[string]os.FileInfo)
@@ -417,14 +648,15 @@ func (w *Watcher) retrieveFileList() (map[string]os.FileInfo, error) {
 	var list map[string]os.FileInfo
 	var err error
 
+	w.setRealRoots()
+
 	for name, recursive := range w.names {
 		if recursive {
 			list, err = w.listRecursive(name)
 			if err != nil {
 				if os.IsNotExist(err) {
-					if name == err.(*os.PathError).Path {
+					if isPathError(err, name) {
 						return nil, ErrWatchedFileDeleted
-						w.RemoveRecursive(name)
 					}
 				} else {
 					return nil, err
@@ -434,9 +666,8 @@ func (w *Watcher) retrieveFileList() (map[string]os.FileInfo, error) {
 			list, err = w.list(name)
 			if err != nil {
 				if os.IsNotExist(err) {
-					if name == err.(*os.PathError).Path {
+					if isPathError(err, name) {
 						return nil, ErrWatchedFileDeleted
-						w.Remove(name)
 					}
 				} else {
 					return nil, err
@@ -452,90 +683,94 @@ func (w *Watcher) retrieveFileList() (map[string]os.FileInfo, error) {
 	return fileList, nil
 }
 
+// Diff returns the changes made to the watched files since the baseline
+// was taken. The baseline itself is not changed; see Commit.
 func (w *Watcher) Diff() ([]Event, error) {
+	// A failed Diff leaves nothing for Commit to adopt.
+	w.scanned = nil
 
-	fileList, err := w.retrieveFileList()
+	scanned, err := w.Scan()
 	if err != nil {
 		return nil, err
 	}
-	diff := w.getDiff(fileList)
-	return diff, nil
+	w.scanned = &scanned
+	return w.getDiff(scanned.Files), nil
 }
 
-func (w *Watcher) getDiff(files map[string]os.FileInfo) []Event {
-
-	var res []Event
-
-	// Store create and remove events for use to check for rename events.
-	creates := make(map[string]os.FileInfo)
-	removes := make(map[string]os.FileInfo)
-
-	// Check for removed files.
-	for path, info := range w.files {
-		if _, found := files[path]; !found {
-			removes[path] = info
-		}
+// Scan lists the watched files as a Snapshot, without changing the
+// Watcher's baseline. It applies the same filters as Add and AddRecursive.
+//
+// In DetectHybrid mode, files that look unchanged since the baseline
+// reuse the content hash recorded in it.
+func (w *Watcher) Scan() (Snapshot, error) {
+	taken := time.Now()
+	fileList, err := w.retrieveFileList()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if err := w.hashFiles(fileList, w.files); err != nil {
+		return Snapshot{}, err
+	}
+	if err := w.markRacy(fileList, taken); err != nil {
+		return Snapshot{}, err
+	}
+	if err := w.readXattrs(fileList); err != nil {
+		return Snapshot{}, err
 	}
 
-	// Check for created files, writes and chmods.
-	for path, info := range files {
-		oldInfo, found := w.files[path]
-		if !found {
-			// A file was created.
-			creates[path] = info
-			continue
-		}
-		if oldInfo.ModTime() != info.ModTime() {
-			res = append(res, Event{Write, path, path, info})
+	s := Snapshot{
+		Taken: taken,
+		Roots: make(map[string]bool, len(w.names)),
+		Files: fileList,
+	}
+	for k, v := range w.names {
+		s.Roots[k] = v
+	}
+	return s, nil
+}
 
+// Commit moves the baseline to the files seen by the last call to Diff,
+// so that the next Diff reports only what changed since then.
+//
+// If the watched files were changed by Add, Remove or the like since the
+// last Diff, or the last Diff failed or was never called, the files are
+// listed again.
+func (w *Watcher) Commit() error {
+	if w.scanned == nil {
+		scanned, err := w.Scan()
+		if err != nil {
+			return err
 		}
-		if oldInfo.Mode() != info.Mode() {
-			res = append(res, Event{Chmod, path, path, info})
-		}
+		w.scanned = &scanned
 	}
 
-	// Check for renames and moves.
-	for path1, info1 := range removes {
-		for path2, info2 := range creates {
-			if sameFile(info1, info2) {
-				e := Event{
-					Op:       Move,
-					Path:     path2,
-					OldPath:  path1,
-					FileInfo: info1,
-				}
-				// If they are from the same directory, it's a rename
-				// instead of a move event.
-				if filepath.Dir(path1) == filepath.Dir(path2) {
-					e.Op = Rename
-				}
-
-				delete(removes, path1)
-				delete(creates, path2)
-
-				res = append(res, e)
+	w.files = w.scanned.Files
+	w.taken = w.scanned.Taken
+	w.scanned = nil
+	return nil
+}
 
-			}
-		}
+// DiffCommit is like Diff, but also moves the baseline to the current
+// state of the watched files, as if Commit was called right after.
+func (w *Watcher) DiffCommit() ([]Event, error) {
+	diff, err := w.Diff()
+	if err != nil {
+		return nil, err
 	}
+	return diff, w.Commit()
+}
 
-	// Send all the remaining create and remove events.
-	for path, info := range creates {
-		res = append(res, Event{Create, path, "", info})
-	}
-	for path, info := range removes {
-		res = append(res, Event{Remove, path, path, info})
-	}
+// getDiff compares the baseline with files and filters the resulting
+// events by the watcher's Op filter.
+func (w *Watcher) getDiff(files map[string]os.FileInfo) []Event {
+
+	res := CompareWith(Snapshot{Files: w.files}, Snapshot{Files: files}, w.compareOptions())
 
-	var filteredRes = res
 	if len(w.ops) > 0 { // Filter Ops.
-		filteredRes = nil
-		for _, event := range res {
-			_, found := w.ops[event.Op]
-			if found {
-				filteredRes = append(filteredRes, event)
-			}
-		}
+		res = filterOps(res, w.ops, w.compare.Coalesce)
+	}
+	if len(w.types) > 0 { // Filter FileTypes.
+		res = filterTypes(res, w.types)
 	}
-	return filteredRes
+	return res
 }
@@ -78,6 +78,10 @@ func TestEventString(t *testing.T) {
 			&fileInfo{name: "f2", dir: false},
 			"FILE \"f2\" CREATE [/fake/path]",
 		},
+		{
+			&fileInfo{name: "f3", mode: os.ModeNamedPipe},
+			"FIFO \"f3\" CREATE [/fake/path]",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -509,4 +513,105 @@ func TestEventAddFile(t *testing.T) {
 	if len(diff) != len(files) {
 		t.Errorf("received wrong numbers of events")
 	}
-}
\ No newline at end of file
+}
+
+func TestCommit(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	w.FilterOps(Create)
+
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	newFile1 := filepath.Join(testDir, "newfile_1.txt")
+	if err := ioutil.WriteFile(newFile1, []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := w.DiffCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 1 || diff[0].Path != newFile1 {
+		t.Errorf("expected create of %s, got %v", newFile1, diff)
+	}
+
+	newFile2 := filepath.Join(testDir, "newfile_2.txt")
+	if err := ioutil.WriteFile(newFile2, []byte{}, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Without a Commit, the baseline stays the same.
+	for i := 0; i < 2; i++ {
+		diff, err = w.Diff()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diff) != 1 || diff[0].Path != newFile2 {
+			t.Errorf("expected create of %s, got %v", newFile2, diff)
+		}
+	}
+
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	diff, err = w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 0 {
+		t.Errorf("expected no events after Commit, got %v", diff)
+	}
+	if _, found := w.files[newFile2]; !found {
+		t.Errorf("expected to find %s", newFile2)
+	}
+}
+
+func TestCommitAfterFilterChange(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Diff(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The scan of the Diff was taken with hidden files, so Commit must
+	// not adopt it.
+	w.IgnoreHiddenFiles(true)
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := w.files[filepath.Join(testDir, ".dotfile")]; found {
+		t.Errorf("expected .dotfile to be left out of the baseline")
+	}
+}
+
+func TestCommitAfterFailedDiff(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	w := New()
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Diff(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The scan of the first Diff is stale once a later Diff fails, so
+	// Commit must list the files again, and fail the same way.
+	if err := os.RemoveAll(testDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Diff(); err != ErrWatchedFileDeleted {
+		t.Fatalf("expected %v, got %v", ErrWatchedFileDeleted, err)
+	}
+	if err := w.Commit(); err != ErrWatchedFileDeleted {
+		t.Errorf("expected %v, got %v", ErrWatchedFileDeleted, err)
+	}
+}
@@ -0,0 +1,160 @@
+package dirchanges
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path"
+	"sort"
+)
+
+// DefaultMaxXattrSize is the size above which the value of an extended
+// attribute is recorded by its hash, unless XattrOptions says otherwise.
+const DefaultMaxXattrSize = 256
+
+// XattrOptions selects the extended attributes a Watcher records, such
+// as security.capability, security.selinux or system.posix_acl_access.
+type XattrOptions struct {
+	// Include are path.Match patterns of the names of the attributes to
+	// record, like "security.*". When empty, all attributes are recorded.
+	Include []string
+
+	// Exclude are patterns of the names of attributes not to record,
+	// even when they are included.
+	Exclude []string
+
+	// MaxValueSize is the size above which a value is recorded by its
+	// SHA-256 hash. When 0, DefaultMaxXattrSize is used.
+	MaxValueSize int
+}
+
+// XattrChanges lists the names of the extended attributes of a file that
+// were added, removed or modified, in order.
+type XattrChanges struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// xattrValue is the recorded value of an extended attribute, as is or by
+// its hash when it's too large.
+type xattrValue struct {
+	Value []byte `json:"value,omitempty"`
+	Hash  []byte `json:"sha256,omitempty"`
+}
+
+// SetXattrs makes the watcher record the extended attributes of files
+// selected by opts, and report their changes as Xattr events. It returns
+// an error if one of the patterns is malformed.
+//
+// Extended attributes are only read on linux, from the OS file system,
+// for files added after SetXattrs is called.
+func (w *Watcher) SetXattrs(opts XattrOptions) error {
+	for _, pattern := range append(opts.Include, opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	w.xattrs = &opts
+	w.scanned = nil
+	return nil
+}
+
+// recorded reports whether the attribute called name is selected by o.
+func (o *XattrOptions) recorded(name string) bool {
+	included := len(o.Include) == 0
+	for _, pattern := range o.Include {
+		if ok, _ := path.Match(pattern, name); ok {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range o.Exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// readXattrs records the selected extended attributes of each of files,
+// if the watcher records them. Files removed since they were listed are
+// dropped from files.
+func (w *Watcher) readXattrs(files map[string]os.FileInfo) error {
+	if w.xattrs == nil {
+		return nil
+	}
+	if _, ok := w.fs.(osFileSystem); !ok {
+		return nil
+	}
+	max := w.xattrs.MaxValueSize
+	if max == 0 {
+		max = DefaultMaxXattrSize
+	}
+
+	for path, info := range files {
+		fi := toFileInfo(info)
+		files[path] = fi
+
+		attrs, err := listXattrs(path, fi.mode&os.ModeSymlink == 0)
+		if os.IsNotExist(err) {
+			// The file was removed since it was listed.
+			delete(files, path)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if attrs == nil {
+			// The platform has no extended attributes.
+			return nil
+		}
+		fi.xattrs = make(map[string]xattrValue)
+		for name, value := range attrs {
+			if !w.xattrs.recorded(name) {
+				continue
+			}
+			if len(value) > max {
+				sum := sha256.Sum256(value)
+				fi.xattrs[name] = xattrValue{Hash: sum[:]}
+				continue
+			}
+			fi.xattrs[name] = xattrValue{Value: value}
+		}
+	}
+	return nil
+}
+
+// xattrChanges returns how the extended attributes of a file changed from
+// oldFi to fi. Nothing changed unless both recorded them.
+func xattrChanges(oldFi, fi *fileInfo) XattrChanges {
+	var c XattrChanges
+	if oldFi.xattrs == nil || fi.xattrs == nil {
+		return c
+	}
+	for name, value := range fi.xattrs {
+		oldValue, found := oldFi.xattrs[name]
+		if !found {
+			c.Added = append(c.Added, name)
+		} else if !bytes.Equal(oldValue.Value, value.Value) || !bytes.Equal(oldValue.Hash, value.Hash) {
+			c.Modified = append(c.Modified, name)
+		}
+	}
+	for name := range oldFi.xattrs {
+		if _, found := fi.xattrs[name]; !found {
+			c.Removed = append(c.Removed, name)
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.Strings(c.Modified)
+	return c
+}
+
+// empty reports whether no attribute changed.
+func (c XattrChanges) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Modified) == 0
+}
@@ -0,0 +1,104 @@
+// +build linux
+
+package dirchanges
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// listXattrs returns the extended attributes of the named file, or of the
+// symbolic link itself unless follow is set. A file system that doesn't
+// support them has none.
+func listXattrs(name string, follow bool) (map[string][]byte, error) {
+	list, get := uintptr(syscall.SYS_LLISTXATTR), uintptr(syscall.SYS_LGETXATTR)
+	if follow {
+		list, get = syscall.SYS_LISTXATTR, syscall.SYS_GETXATTR
+	}
+
+	attrs := make(map[string][]byte)
+	names, err := xattrCall(list, name, "")
+	if errors.Is(err, syscall.ENOTSUP) {
+		return attrs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range bytes.Split(names, []byte{0}) {
+		if len(attr) == 0 {
+			continue
+		}
+		value, err := xattrCall(get, name, string(attr))
+		if errors.Is(err, syscall.ENODATA) {
+			// The attribute was removed since it was listed.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		attrs[string(attr)] = value
+	}
+	return attrs, nil
+}
+
+// xattrCall makes the listxattr or getxattr system call trap on the named
+// file, with attr for getxattr, and returns the result. The size of the
+// result is asked first, and asked again if it changed in between.
+// Errors are *os.PathError.
+func xattrCall(trap uintptr, name, attr string) ([]byte, error) {
+	op := "listxattr"
+	if attr != "" {
+		op = "getxattr"
+	}
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	var a *byte
+	if attr != "" {
+		if a, err = syscall.BytePtrFromString(attr); err != nil {
+			return nil, &os.PathError{Op: op, Path: name, Err: err}
+		}
+	}
+
+	for {
+		call := func(dest []byte) (int, error) {
+			var d unsafe.Pointer
+			if len(dest) > 0 {
+				d = unsafe.Pointer(&dest[0])
+			}
+			var r uintptr
+			var errno syscall.Errno
+			if a == nil {
+				r, _, errno = syscall.Syscall(trap, uintptr(unsafe.Pointer(p)), uintptr(d), uintptr(len(dest)))
+			} else {
+				r, _, errno = syscall.Syscall6(trap, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(a)),
+					uintptr(d), uintptr(len(dest)), 0, 0)
+			}
+			if errno != 0 {
+				return 0, errno
+			}
+			return int(r), nil
+		}
+
+		size, err := call(nil)
+		if err != nil {
+			return nil, &os.PathError{Op: op, Path: name, Err: err}
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		dest := make([]byte, size)
+		n, err := call(dest)
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: op, Path: name, Err: err}
+		}
+		return dest[:n], nil
+	}
+}
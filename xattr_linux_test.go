@@ -0,0 +1,91 @@
+// +build linux
+
+package dirchanges
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestXattrs(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	name := filepath.Join(testDir, "file.txt")
+	err := syscall.Setxattr(name, "user.small", []byte("small"), 0)
+	if err == syscall.ENOTSUP {
+		t.Skip("extended attributes are not supported")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	large := []byte(strings.Repeat("x", DefaultMaxXattrSize+1))
+	if err := syscall.Setxattr(name, "user.large", large, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New()
+	if err := w.SetXattrs(XattrOptions{Include: []string{"user.*"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddRecursive(testDir); err != nil {
+		t.Fatal(err)
+	}
+
+	xattrs := toFileInfo(w.files[name]).xattrs
+	if !bytes.Equal(xattrs["user.small"].Value, []byte("small")) {
+		t.Errorf("expected user.small to be recorded as is, got %v", xattrs["user.small"])
+	}
+	if v := xattrs["user.large"]; v.Value != nil || len(v.Hash) == 0 {
+		t.Errorf("expected user.large to be recorded by its hash, got %v", v)
+	}
+
+	large[0] = 'y'
+	if err := syscall.Setxattr(name, "user.large", large, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Removexattr(name, "user.small"); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := w.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 1 {
+		t.Fatalf("expected 1 event, got %v", eventStrings(diff))
+	}
+	expected := XattrChanges{Removed: []string{"user.small"}, Modified: []string{"user.large"}}
+	if e := diff[0]; e.Op != Xattr || !reflect.DeepEqual(e.Xattrs, expected) {
+		t.Errorf("expected %v, got %s %v", expected, e.Op, e.Xattrs)
+	}
+}
+
+func TestXattrsOfRemovedFile(t *testing.T) {
+	testDir, teardown := setup(t)
+	defer teardown()
+
+	name := filepath.Join(testDir, "removed.txt")
+	_, err := listXattrs(name, true)
+	if pathErr, ok := err.(*os.PathError); !ok || pathErr.Op != "listxattr" || pathErr.Path != name {
+		t.Errorf("expected a listxattr error about %s, got %v", name, err)
+	}
+
+	// A file removed since it was listed is dropped.
+	w := New()
+	if err := w.SetXattrs(XattrOptions{Include: []string{"user.*"}}); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]os.FileInfo{name: &fileInfo{name: "removed.txt", mode: 0644}}
+	if err := w.readXattrs(files); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := files[name]; found {
+		t.Errorf("expected %s to be dropped", name)
+	}
+}
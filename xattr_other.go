@@ -0,0 +1,8 @@
+// +build !linux
+
+package dirchanges
+
+// listXattrs returns nil, as extended attributes are only read on linux.
+func listXattrs(name string, follow bool) (map[string][]byte, error) {
+	return nil, nil
+}
@@ -0,0 +1,69 @@
+package dirchanges
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestXattrOptions(t *testing.T) {
+	opts := XattrOptions{
+		Include: []string{"security.*", "system.posix_acl_*"},
+		Exclude: []string{"security.ima"},
+	}
+	testCases := map[string]bool{
+		"security.capability":     true,
+		"security.selinux":        true,
+		"security.ima":            false,
+		"system.posix_acl_access": true,
+		"user.comment":            false,
+	}
+	for name, expected := range testCases {
+		if recorded := opts.recorded(name); recorded != expected {
+			t.Errorf("expected %s to be recorded: %t", name, expected)
+		}
+	}
+
+	if err := New().SetXattrs(XattrOptions{Exclude: []string{"["}}); err == nil {
+		t.Errorf("expected an error for a malformed pattern")
+	}
+}
+
+func TestCompareXattrs(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	file := func(xattrs map[string]xattrValue) *fileInfo {
+		return &fileInfo{name: "f", mode: 0644, modTime: t1, xattrs: xattrs}
+	}
+	value := func(v string) xattrValue { return xattrValue{Value: []byte(v)} }
+
+	old := Snapshot{Files: map[string]os.FileInfo{
+		"/d/f": file(map[string]xattrValue{
+			"security.selinux": value("a"),
+			"user.kept":        value("b"),
+			"user.removed":     value("c"),
+		}),
+		"/d/unrecorded": file(nil),
+	}}
+	new := Snapshot{Files: map[string]os.FileInfo{
+		"/d/f": file(map[string]xattrValue{
+			"security.selinux":    value("x"),
+			"user.kept":           value("b"),
+			"security.capability": value("y"),
+		}),
+		"/d/unrecorded": file(map[string]xattrValue{"user.added": value("z")}),
+	}}
+
+	events := Compare(old, new)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %v", eventStrings(events))
+	}
+	expected := XattrChanges{
+		Added:    []string{"security.capability"},
+		Removed:  []string{"user.removed"},
+		Modified: []string{"security.selinux"},
+	}
+	if e := events[0]; e.Op != Xattr || e.Path != "/d/f" || !reflect.DeepEqual(e.Xattrs, expected) {
+		t.Errorf("expected %v, got %s %s %v", expected, e.Op, e.Path, e.Xattrs)
+	}
+}